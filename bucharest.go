@@ -3,6 +3,7 @@ package bucharest
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
@@ -17,7 +18,17 @@ type ContextOptions struct {
 	Parent context.Context
 	SQL    *sql.DB
 	SQLX   *sqlx.DB
-	Redis  *redis.Client
+	Redis  redis.UniversalClient
+
+	Replicas                   []Replica
+	ReplicaPolicy              ReplicaPolicy
+	ReplicaHealthCheckInterval time.Duration
+
+	QueryLog *QueryLogOptions
+
+	// RequireTenant makes GORM, Redis, SQL, SQLX and their handles panic with
+	// ErrUnscopedHandle until TenantRegistry.Middleware scopes the context.
+	RequireTenant bool
 }
 
 type BuchatrestContext struct {
@@ -25,9 +36,18 @@ type BuchatrestContext struct {
 	env     ENV
 	gorm_   *gorm.DB
 	logrus_ *logrus.Logger
-	redis_  *redis.Client
+	redis_  redis.UniversalClient
 	sql_    *sql.DB
 	sqlx_   *sqlx.DB
+	tx      *transaction
+
+	queryLog *queryLogger
+
+	tenant        string
+	requireTenant bool
+
+	replicas *replicaSet
+	primary  *BuchatrestContext
 }
 
 func NewContextWithOptions(options *ContextOptions) Context {
@@ -37,15 +57,23 @@ func NewContextWithOptions(options *ContextOptions) Context {
 	if options.Parent == nil {
 		options.Parent = context.Background()
 	}
-	return &BuchatrestContext{
-		Context: options.Parent,
-		env:     options.ENV,
-		gorm_:   options.GORM,
-		logrus_: options.Logrus,
-		redis_:  options.Redis,
-		sql_:    options.SQL,
-		sqlx_:   options.SQLX,
+	ctx := &BuchatrestContext{
+		Context:  options.Parent,
+		env:      options.ENV,
+		gorm_:    options.GORM,
+		logrus_:  options.Logrus,
+		redis_:   options.Redis,
+		sql_:     options.SQL,
+		sqlx_:    options.SQLX,
+		replicas: newReplicaSet(options.Replicas, options.ReplicaPolicy),
+		queryLog: newQueryLogger(options.QueryLog, options.Logrus),
+
+		requireTenant: options.RequireTenant,
+	}
+	if ctx.replicas != nil && options.ReplicaHealthCheckInterval > 0 {
+		ctx.replicas.start(options.Parent, options.ReplicaHealthCheckInterval)
 	}
+	return ctx
 }
 
 func (d *BuchatrestContext) String() string {
@@ -59,9 +87,17 @@ func (ctx *BuchatrestContext) ENV() ENV {
 }
 
 func (ctx *BuchatrestContext) GORM() *gorm.DB {
+	return ctx.gorm(ctx)
+}
+
+func (ctx *BuchatrestContext) gorm(caller context.Context) *gorm.DB {
+	ctx.guardTenant()
 	if ctx.gorm_ == nil {
 		panic(ErrNoGORM)
 	}
+	if ctx.queryLog != nil {
+		return ctx.queryLog.gorm(ctx.gorm_).WithContext(caller)
+	}
 	return ctx.gorm_
 }
 
@@ -72,25 +108,108 @@ func (ctx *BuchatrestContext) Log() *logrus.Logger {
 	return ctx.logrus_
 }
 
+// logger is Log for the background work of the package, which falls back to
+// the standard logger instead of panicking.
+func (ctx *BuchatrestContext) logger() *logrus.Logger {
+	if ctx.logrus_ == nil {
+		return logrus.StandardLogger()
+	}
+	return ctx.logrus_
+}
+
 func (ctx *BuchatrestContext) Redis() *redis.Client {
+	ctx.guardTenant()
+	if ctx.redis_ == nil {
+		panic(ErrNoRedis)
+	}
+	client, ok := ctx.redis_.(*redis.Client)
+	if !ok {
+		panic(ErrNotRedisClient)
+	}
+	return client
+}
+
+func (ctx *BuchatrestContext) UniversalRedis() redis.UniversalClient {
+	ctx.guardTenant()
 	if ctx.redis_ == nil {
 		panic(ErrNoRedis)
 	}
 	return ctx.redis_
 }
 
+// HasRedis reports whether UniversalRedis can be called, so that optional
+// Redis backed features can fall back to memory.
+func HasRedis(ctx Context) bool {
+	return baseOf(ctx).redis_ != nil
+}
+
+// SQLDriverName returns the driver name of the database of ctx, taken from its
+// SQLX, SQL or GORM, or "" when it has none.
+func SQLDriverName(ctx Context) string {
+	b := baseOf(ctx)
+	switch {
+	case b.sqlx_ != nil:
+		return b.sqlx_.DriverName()
+	case b.sql_ != nil:
+		return DriverName(b.sql_)
+	case b.gorm_ != nil:
+		if db, err := b.gorm_.DB(); err == nil {
+			if name := DriverName(db); name != "" {
+				return name
+			}
+		}
+		return b.gorm_.Dialector.Name()
+	}
+	return ""
+}
+
+// Logger returns an entry of the logger of ctx, or of the standard logger when
+// ctx has none, with the request ID of ctx. It is the default of the OnError
+// options of the subpackages.
+func Logger(ctx Context) *logrus.Entry {
+	entry := baseOf(ctx).logger().WithContext(ctx)
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
+
 func (ctx *BuchatrestContext) SQL() *sql.DB {
+	ctx.guardTenant()
 	if ctx.sql_ == nil {
 		panic(ErrNoSQL)
 	}
-	return ctx.sql_
+	if ctx.tx != nil {
+		Logger(ctx).Warn(ErrPoolInTx)
+	}
+	return ctx.queryLog.sql(ctx.sql_)
+}
+
+func (ctx *BuchatrestContext) SQLHandle() SQLHandle {
+	ctx.guardTenant()
+	if ctx.tx != nil {
+		return ctx.tx.sql
+	}
+	return ctx.SQL()
 }
 
 func (ctx *BuchatrestContext) SQLX() *sqlx.DB {
+	ctx.guardTenant()
 	if ctx.sqlx_ == nil {
 		panic(ErrNoSQLX)
 	}
-	return ctx.sqlx_
+	if ctx.tx != nil {
+		Logger(ctx).Warn(ErrPoolInTx)
+	}
+	return ctx.queryLog.sqlx(ctx.sqlx_)
+}
+
+func (ctx *BuchatrestContext) SQLXHandle() SQLXHandle {
+	ctx.guardTenant()
+	if ctx.tx != nil && ctx.tx.sqlx != nil {
+		return ctx.tx.sqlx
+	}
+	return ctx.SQLX()
 }
 
 func (ctx *BuchatrestContext) SetValue(key, val interface{}) {
@@ -98,6 +217,13 @@ func (ctx *BuchatrestContext) SetValue(key, val interface{}) {
 }
 
 func (ctx *BuchatrestContext) Update(option *ContextOptions) {
+	if option.QueryLog != nil {
+		ctx.queryLog = newQueryLogger(option.QueryLog, ctx.logrus_)
+		if option.Logrus != nil {
+			ctx.queryLog.logrus = option.Logrus
+		}
+	}
+
 	if option.ENV != nil {
 		ctx.env = option.ENV
 	}
@@ -121,4 +247,57 @@ func (ctx *BuchatrestContext) Update(option *ContextOptions) {
 	if option.SQLX != nil {
 		ctx.sqlx_ = option.SQLX
 	}
+
+	if option.Replicas != nil {
+		interval := option.ReplicaHealthCheckInterval
+		if ctx.replicas != nil {
+			ctx.replicas.stop()
+			if interval == 0 {
+				interval = ctx.replicas.interval
+			}
+		}
+		ctx.replicas = newReplicaSet(option.Replicas, option.ReplicaPolicy)
+		if ctx.replicas != nil && interval > 0 {
+			ctx.replicas.start(ctx.Context, interval)
+		}
+	}
+}
+
+// WithParent returns a Context with the dependencies of ctx, including its
+// transaction and tenant, whose deadline, cancellation and values come from
+// parent. parent is usually derived from ctx, such as with context.WithTimeout.
+func WithParent(ctx Context, parent context.Context) Context {
+	return baseOf(ctx).derive(parent)
+}
+
+func (ctx *BuchatrestContext) base() *BuchatrestContext {
+	return ctx
+}
+
+// baseOf returns the BuchatrestContext behind ctx. A Context implemented
+// outside of this package, such as a wrapper, gets one with the dependencies
+// its accessors return.
+func baseOf(ctx Context) *BuchatrestContext {
+	if b, ok := ctx.(contextBase); ok {
+		return b.base()
+	}
+
+	b := &BuchatrestContext{Context: ctx}
+	dependency := func(get func()) {
+		defer func() { recover() }()
+		get()
+	}
+	dependency(func() { b.env = ctx.ENV() })
+	dependency(func() { b.gorm_ = ctx.GORM() })
+	dependency(func() { b.logrus_ = ctx.Log() })
+	dependency(func() { b.redis_ = ctx.UniversalRedis() })
+	dependency(func() { b.sql_ = ctx.SQL() })
+	dependency(func() { b.sqlx_ = ctx.SQLX() })
+	return b
+}
+
+func (ctx *BuchatrestContext) derive(parent context.Context) *BuchatrestContext {
+	child := *ctx
+	child.Context = parent
+	return &child
 }
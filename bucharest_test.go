@@ -12,6 +12,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -69,6 +70,7 @@ func TestNewContextWithOptionsWithNoAddtionalOptions(t *testing.T) {
 	utils.AssertPanic(t, func() { ctx.GORM() }, ErrNoGORM)
 	utils.AssertPanic(t, func() { ctx.Log() }, ErrNoLogrus)
 	utils.AssertPanic(t, func() { ctx.Redis() }, ErrNoRedis)
+	utils.AssertPanic(t, func() { ctx.UniversalRedis() }, ErrNoRedis)
 	utils.AssertPanic(t, func() { ctx.SQL() }, ErrNoSQL)
 	utils.AssertPanic(t, func() { ctx.SQLX() }, ErrNoSQLX)
 }
@@ -213,3 +215,52 @@ func TestUpdateContext(t *testing.T) {
 	assert.Same(t, sqlx, ctx.SQLX())
 
 }
+
+func TestUniversalRedis(t *testing.T) {
+	client := &redis.Client{}
+	ctx := NewContextWithOptions(&ContextOptions{Redis: client})
+	assert.Same(t, client, ctx.Redis())
+	assert.Same(t, client, ctx.UniversalRedis())
+
+	cluster := &redis.ClusterClient{}
+	ctx = NewContextWithOptions(&ContextOptions{Redis: cluster})
+	assert.Same(t, cluster, ctx.UniversalRedis())
+	utils.AssertPanic(t, func() { ctx.Redis() }, ErrNotRedisClient)
+}
+
+func TestHasRedis(t *testing.T) {
+	assert.False(t, HasRedis(NewContextWithOptions(nil)))
+	assert.True(t, HasRedis(NewContextWithOptions(&ContextOptions{Redis: &redis.Client{}})))
+}
+
+func TestLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	ctx := NewContextWithOptions(&ContextOptions{Logrus: logger})
+	ctx.SetValue(RequestIDKey, "request-1")
+	Logger(ctx).Error("failed")
+	assert.Equal(t, "failed", hook.LastEntry().Message)
+	assert.Equal(t, "request-1", hook.LastEntry().Data["request_id"])
+
+	assert.Same(t, logrus.StandardLogger(), Logger(NewContextWithOptions(nil)).Logger)
+}
+
+func TestSQLDriverName(t *testing.T) {
+	ctx, _ := newMockContext(t)
+	assert.Equal(t, "pgx", SQLDriverName(ctx))
+	gormOnly := NewContextWithOptions(&ContextOptions{GORM: ctx.GORM()})
+	assert.Equal(t, "postgres", SQLDriverName(gormOnly))
+	assert.Equal(t, "", SQLDriverName(NewContextWithOptions(nil)))
+}
+
+func TestWithParent(t *testing.T) {
+	client := &redis.Client{}
+	ctx := NewContextWithOptions(&ContextOptions{Redis: client})
+	parent, cancel := context.WithCancel(ctx)
+	child := WithParent(ctx, parent)
+
+	assert.Same(t, client, child.Redis())
+	assert.NoError(t, child.Err())
+	cancel()
+	assert.ErrorIs(t, child.Err(), context.Canceled)
+	assert.NoError(t, ctx.Err())
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error
+	Delete(ctx context.Context, keys ...string) error
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+const DefaultTagTTL = 24 * time.Hour
+
+// tagScript adds ARGV[1] to the tag set KEYS[1] and makes the set live at
+// least ARGV[2] milliseconds more, or for ever when ARGV[2] is 0. A set is
+// never shortened, so that it outlives every key added to it.
+var tagScript = redis.NewScript(`
+local existed = redis.call("exists", KEYS[1]) == 1
+local current = redis.call("pttl", KEYS[1])
+redis.call("sadd", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call("persist", KEYS[1])
+elseif not existed or (current >= 0 and current < ttl) then
+	redis.call("pexpire", KEYS[1], ttl)
+end
+return 1`)
+
+// RedisBackend keeps each tag as a Redis set of the keys cached with it. A tag
+// set lives for TagTTL after its last key was added, longer if one of its keys
+// does, and for ever once a key without a TTL is added to it.
+type RedisBackend struct {
+	Client redis.UniversalClient
+	TagTTL time.Duration
+}
+
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{Client: client, TagTTL: DefaultTagTTL}
+}
+
+func (b *RedisBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := b.Client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (b *RedisBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	_, err := b.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		tagTTL := max(ttl, b.TagTTL)
+		if ttl == 0 {
+			tagTTL = 0
+		}
+		for _, tag := range tags {
+			tagScript.Eval(ctx, pipe, []string{tag}, key, tagTTL.Milliseconds())
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete sends a DEL per key in one pipeline, which a ClusterClient splits by
+// slot, as a DEL of keys in different slots fails with CROSSSLOT.
+func (b *RedisBackend) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := b.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *RedisBackend) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		keys, err := b.Client.SMembers(ctx, tag).Result()
+		if err != nil {
+			return err
+		}
+		if err := b.Delete(ctx, append(keys, tag)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryBackend is an in-process backend for tests and for the L1 tier. When
+// MaxEntries is reached an arbitrary entry is evicted.
+type MemoryBackend struct {
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	tags    map[string]map[string]struct{}
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+	tags      []string
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+func (b *MemoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		b.remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (b *MemoryBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries == nil {
+		b.entries = make(map[string]memoryEntry)
+		b.tags = make(map[string]map[string]struct{})
+	}
+	if _, ok := b.entries[key]; ok {
+		b.remove(key)
+	} else if b.MaxEntries > 0 && len(b.entries) >= b.MaxEntries {
+		for evicted := range b.entries {
+			b.remove(evicted)
+			break
+		}
+	}
+
+	entry := memoryEntry{value: value, tags: tags}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	b.entries[key] = entry
+	for _, tag := range tags {
+		if b.tags[tag] == nil {
+			b.tags[tag] = make(map[string]struct{})
+		}
+		b.tags[tag][key] = struct{}{}
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Delete(_ context.Context, keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		b.remove(key)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) InvalidateTags(_ context.Context, tags ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, tag := range tags {
+		for key := range b.tags[tag] {
+			b.remove(key)
+		}
+	}
+	return nil
+}
+
+// remove deletes key and takes it out of the sets of its tags, dropping the
+// sets it leaves empty. b.mu must be held.
+func (b *MemoryBackend) remove(key string) {
+	entry, ok := b.entries[key]
+	if !ok {
+		return
+	}
+	delete(b.entries, key)
+	for _, tag := range entry.tags {
+		delete(b.tags[tag], key)
+		if len(b.tags[tag]) == 0 {
+			delete(b.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/cache"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), time.Millisecond, []string{"tag"}))
+	assert.NoError(t, backend.Set(ctx, "b", []byte("2"), 0, []string{"tag"}))
+	assert.NoError(t, backend.Set(ctx, "c", []byte("3"), 0, nil))
+
+	time.Sleep(5 * time.Millisecond)
+	_, ok, err := backend.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	value, ok, _ := backend.Get(ctx, "b")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), value)
+
+	assert.NoError(t, backend.InvalidateTags(ctx, "tag"))
+	_, ok, _ = backend.Get(ctx, "b")
+	assert.False(t, ok)
+
+	assert.NoError(t, backend.Delete(ctx, "c"))
+	_, ok, _ = backend.Get(ctx, "c")
+	assert.False(t, ok)
+}
+
+func TestMemoryBackendMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	backend := &MemoryBackend{MaxEntries: 2}
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, backend.Set(ctx, key, []byte(key), 0, nil))
+	}
+
+	found := 0
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok, _ := backend.Get(ctx, key); ok {
+			found++
+		}
+	}
+	assert.Equal(t, 2, found)
+}
+
+func TestMemoryBackendForgetsTagsOfRemovedKeys(t *testing.T) {
+	ctx := context.Background()
+	backend := &MemoryBackend{MaxEntries: 1}
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), 0, []string{"old"}))
+	assert.NoError(t, backend.Delete(ctx, "a"))
+	assert.NoError(t, backend.Set(ctx, "a", []byte("2"), 0, []string{"new"}))
+	assert.NoError(t, backend.InvalidateTags(ctx, "old"))
+	_, ok, _ := backend.Get(ctx, "a")
+	assert.True(t, ok)
+
+	// b evicts a, which must leave the tag new.
+	assert.NoError(t, backend.Set(ctx, "b", []byte("3"), 0, nil))
+	assert.NoError(t, backend.Set(ctx, "a", []byte("4"), 0, nil))
+	assert.NoError(t, backend.InvalidateTags(ctx, "new"))
+	_, ok, _ = backend.Get(ctx, "a")
+	assert.True(t, ok)
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("5"), time.Millisecond, []string{"expiring"}))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = backend.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.NoError(t, backend.Set(ctx, "a", []byte("6"), 0, nil))
+	assert.NoError(t, backend.InvalidateTags(ctx, "expiring"))
+	_, ok, _ = backend.Get(ctx, "a")
+	assert.True(t, ok)
+}
+
+func TestRedisBackend(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	_, ok, err := backend.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), time.Minute, []string{"tag"}))
+	value, ok, err := backend.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, time.Minute, mr.TTL("a"))
+	assert.Equal(t, DefaultTagTTL, mr.TTL("tag"))
+
+	assert.NoError(t, backend.InvalidateTags(ctx, "tag"))
+	assert.False(t, mr.Exists("a"))
+
+	assert.NoError(t, backend.Set(ctx, "b", []byte("2"), 0, nil))
+	assert.NoError(t, backend.Delete(ctx, "b"))
+	assert.False(t, mr.Exists("b"))
+}
+
+func TestRedisBackendTagsOutliveTheirKeys(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), 48*time.Hour, []string{"tag"}))
+	assert.Equal(t, 48*time.Hour, mr.TTL("tag"))
+	assert.NoError(t, backend.Set(ctx, "b", []byte("2"), time.Minute, []string{"tag"}))
+	assert.Equal(t, 48*time.Hour, mr.TTL("tag"))
+
+	assert.NoError(t, backend.Set(ctx, "c", []byte("3"), 0, []string{"tag"}))
+	assert.Equal(t, time.Duration(0), mr.TTL("tag"))
+	assert.NoError(t, backend.Set(ctx, "d", []byte("4"), time.Minute, []string{"tag"}))
+	assert.Equal(t, time.Duration(0), mr.TTL("tag"))
+
+	mr.FastForward(72 * time.Hour)
+	assert.True(t, mr.Exists("c"))
+	assert.NoError(t, backend.InvalidateTags(ctx, "tag"))
+	assert.False(t, mr.Exists("c"))
+}
+
+type delHook struct {
+	keys []int
+}
+
+func (h *delHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *delHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *delHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		if cmd.Name() == "del" {
+			h.keys = append(h.keys, len(cmd.Args())-1)
+		}
+	}
+	return ctx, nil
+}
+
+func (h *delHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func TestRedisBackendDeletesKeyByKey(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	hook := &delHook{}
+	client.AddHook(hook)
+	backend := NewRedisBackend(client)
+
+	assert.NoError(t, backend.Set(ctx, "a", []byte("1"), 0, []string{"tag"}))
+	assert.NoError(t, backend.Set(ctx, "b", []byte("2"), 0, []string{"tag"}))
+	assert.NoError(t, backend.Set(ctx, "c", []byte("3"), 0, nil))
+	assert.NoError(t, backend.InvalidateTags(ctx, "tag"))
+	assert.NoError(t, backend.Delete(ctx, "c", "d"))
+
+	assert.Equal(t, []int{1, 1, 1, 1, 1}, hook.keys)
+	assert.False(t, mr.Exists("a"))
+	assert.False(t, mr.Exists("b"))
+	assert.False(t, mr.Exists("c"))
+	assert.False(t, mr.Exists("tag"))
+}
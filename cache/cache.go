@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+const DefaultJitter = 0.1
+const DefaultL1MaxEntries = 10000
+
+// ErrNotFound is returned for keys whose loader reported a missing record and
+// that are negatively cached. Loaders may return it, sql.ErrNoRows or
+// gorm.ErrRecordNotFound.
+var ErrNotFound = errors.New("not found")
+
+const (
+	valueEntry    byte = 'v'
+	notFoundEntry byte = 'n'
+)
+
+type Options struct {
+	// Backend defaults to the Redis client of the context.
+	Backend Backend
+	Codec   Codec
+	Prefix  string
+	// Jitter spreads each TTL by up to ±Jitter of itself so that keys cached
+	// together do not expire together. Set it below zero to disable it.
+	Jitter      float64
+	NegativeTTL time.Duration
+	// L1TTL enables an in-process tier in front of the backend. Invalidation only
+	// reaches the L1 tier of the process that made it, so keep it short.
+	L1TTL        time.Duration
+	L1MaxEntries int
+	// OnError is called with the backend errors that the cache works around.
+	// By default they are warnings in the log of the caller's context.
+	OnError func(err error)
+}
+
+type Cache struct {
+	options *Options
+	group   singleflight.Group
+	l1      *MemoryBackend
+}
+
+var Default = New(nil)
+
+func New(options *Options) *Cache {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Codec == nil {
+		o.Codec = JSON
+	}
+	if o.Jitter == 0 {
+		o.Jitter = DefaultJitter
+	}
+	if o.L1MaxEntries == 0 {
+		o.L1MaxEntries = DefaultL1MaxEntries
+	}
+
+	c := &Cache{options: o}
+	if o.L1TTL > 0 {
+		c.l1 = &MemoryBackend{MaxEntries: o.L1MaxEntries}
+	}
+	return c
+}
+
+// GetOrLoad reads key from the Default cache, calling loader on a miss.
+// Concurrent misses of a key in this process share one loader call.
+func GetOrLoad[T any](ctx bucharest.Context, key string, ttl time.Duration, loader func() (T, error), tags ...string) (T, error) {
+	return GetOrLoadWith(ctx, Default, key, ttl, loader, tags...)
+}
+
+func GetOrLoadWith[T any](ctx bucharest.Context, c *Cache, key string, ttl time.Duration, loader func() (T, error), tags ...string) (T, error) {
+	var value T
+	entry, err := c.entry(ctx, key, ttl, tags, func() ([]byte, error) {
+		loaded, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		return c.options.Codec.Marshal(loaded)
+	})
+	if err != nil {
+		return value, err
+	}
+	if entry[0] == notFoundEntry {
+		return value, ErrNotFound
+	}
+	return value, c.options.Codec.Unmarshal(entry[1:], &value)
+}
+
+func (c *Cache) Delete(ctx bucharest.Context, keys ...string) error {
+	full := make([]string, len(keys))
+	local := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.options.Prefix + key
+		local[i] = c.localKey(ctx, key)
+	}
+	if c.l1 != nil {
+		c.l1.Delete(ctx, local...)
+	}
+	return c.backend(ctx).Delete(ctx, full...)
+}
+
+func (c *Cache) InvalidateTags(ctx bucharest.Context, tags ...string) error {
+	if c.l1 != nil {
+		c.l1.InvalidateTags(ctx, c.localTags(ctx, tags)...)
+	}
+	return c.backend(ctx).InvalidateTags(ctx, c.tags(tags)...)
+}
+
+func (c *Cache) entry(ctx bucharest.Context, key string, ttl time.Duration, tags []string, load func() ([]byte, error)) ([]byte, error) {
+	local := c.localKey(ctx, key)
+	if c.l1 != nil {
+		if entry, ok, _ := c.l1.Get(ctx, local); ok {
+			return entry, nil
+		}
+	}
+
+	result, err, _ := c.group.Do(local, func() (any, error) {
+		backend := c.backend(ctx)
+		full := c.options.Prefix + key
+		entry, ok, err := backend.Get(ctx, full)
+		if err != nil {
+			c.onError(ctx, err)
+		}
+		if ok && len(entry) > 0 {
+			c.setL1(ctx, local, entry, ttl, tags)
+			return entry, nil
+		}
+
+		payload, loadErr := load()
+		switch {
+		case loadErr == nil:
+			entry = append([]byte{valueEntry}, payload...)
+		case isNotFound(loadErr) && c.options.NegativeTTL > 0:
+			entry = []byte{notFoundEntry}
+			ttl = c.options.NegativeTTL
+		default:
+			return nil, loadErr
+		}
+
+		ttl = c.jitter(ttl)
+		if err := backend.Set(ctx, full, entry, ttl, c.tags(tags)); err != nil {
+			c.onError(ctx, err)
+		}
+		c.setL1(ctx, local, entry, ttl, tags)
+		if loadErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, loadErr)
+		}
+		return entry, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+func (c *Cache) onError(ctx bucharest.Context, err error) {
+	if c.options.OnError != nil {
+		c.options.OnError(err)
+		return
+	}
+	bucharest.Logger(ctx).WithError(err).Warn("cache backend failed")
+}
+
+func (c *Cache) backend(ctx bucharest.Context) Backend {
+	if c.options.Backend != nil {
+		return c.options.Backend
+	}
+	return NewRedisBackend(ctx.UniversalRedis())
+}
+
+func (c *Cache) setL1(ctx bucharest.Context, key string, entry []byte, ttl time.Duration, tags []string) {
+	if c.l1 == nil {
+		return
+	}
+	l1TTL := c.options.L1TTL
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+	c.l1.Set(ctx, key, entry, l1TTL, c.localTags(ctx, tags))
+}
+
+// localKey scopes the L1 tier and the de-duplication of misses to the tenant,
+// the backend is already scoped by the tenant's Redis key prefix.
+func (c *Cache) localKey(ctx bucharest.Context, key string) string {
+	return bucharest.Tenant(ctx) + "\x00" + c.options.Prefix + key
+}
+
+func (c *Cache) localTags(ctx bucharest.Context, tags []string) []string {
+	local := make([]string, len(tags))
+	for i, tag := range tags {
+		local[i] = c.localKey(ctx, "tag:"+tag)
+	}
+	return local
+}
+
+func (c *Cache) tags(tags []string) []string {
+	full := make([]string, len(tags))
+	for i, tag := range tags {
+		full[i] = c.options.Prefix + "tag:" + tag
+	}
+	return full
+}
+
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.options.Jitter < 0 {
+		return ttl
+	}
+	spread := float64(ttl) * c.options.Jitter
+	return ttl + time.Duration(spread*(2*rand.Float64()-1))
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, sql.ErrNoRows) || errors.Is(err, gorm.ErrRecordNotFound)
+}
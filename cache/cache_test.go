@@ -0,0 +1,200 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/cache"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type user struct {
+	ID   int    `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func countingLoader(calls *int32, value user, err error) func() (user, error) {
+	return func() (user, error) {
+		atomic.AddInt32(calls, 1)
+		return value, err
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx, mr := newRedisContext(t)
+	var calls int32
+	loader := countingLoader(&calls, user{ID: 1, Name: "alice"}, nil)
+
+	for i := 0; i < 2; i++ {
+		u, err := GetOrLoad(ctx, "user:1", time.Minute, loader)
+		assert.NoError(t, err)
+		assert.Equal(t, user{ID: 1, Name: "alice"}, u)
+	}
+	assert.Equal(t, int32(1), calls)
+
+	value, err := mr.Get("user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, `v{"id":1,"name":"alice"}`, value)
+	assert.InDelta(t, time.Minute, mr.TTL("user:1"), float64(6*time.Second))
+}
+
+func TestGetOrLoadMsgPack(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	c := New(&Options{Backend: NewMemoryBackend(), Codec: MsgPack})
+	var calls int32
+	loader := countingLoader(&calls, user{ID: 1, Name: "alice"}, nil)
+
+	for i := 0; i < 2; i++ {
+		u, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, loader)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", u.Name)
+	}
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestGetOrLoadDeduplicatesMisses(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	c := New(&Options{Backend: NewMemoryBackend()})
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (user, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return user{ID: 1}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, u.ID)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestGetOrLoadNegativeCaching(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	var calls int32
+	loader := countingLoader(&calls, user{}, gorm.ErrRecordNotFound)
+
+	c := New(&Options{Backend: NewMemoryBackend(), NegativeTTL: time.Minute})
+	_, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, loader)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = GetOrLoadWith(ctx, c, "user:1", time.Minute, loader)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(1), calls)
+
+	calls = 0
+	uncached := New(&Options{Backend: NewMemoryBackend()})
+	for i := 0; i < 2; i++ {
+		_, err = GetOrLoadWith(ctx, uncached, "user:1", time.Minute, loader)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	}
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestGetOrLoadDoesNotCacheErrors(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	c := New(&Options{Backend: NewMemoryBackend(), NegativeTTL: time.Minute})
+	var calls int32
+	loadErr := errors.New("database is down")
+
+	for i := 0; i < 2; i++ {
+		_, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, countingLoader(&calls, user{}, loadErr))
+		assert.ErrorIs(t, err, loadErr)
+	}
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestInvalidateTags(t *testing.T) {
+	ctx, mr := newRedisContext(t)
+	c := New(&Options{Prefix: "app:"})
+	var calls int32
+	loader := countingLoader(&calls, user{ID: 1}, nil)
+
+	_, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("app:user:1"))
+	members, err := mr.Members("app:tag:users")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app:user:1"}, members)
+
+	assert.NoError(t, c.InvalidateTags(ctx, "users"))
+	assert.False(t, mr.Exists("app:user:1"))
+	assert.False(t, mr.Exists("app:tag:users"))
+
+	_, err = GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestL1(t *testing.T) {
+	ctx, mr := newRedisContext(t)
+	c := New(&Options{L1TTL: time.Minute})
+	var calls int32
+	loader := countingLoader(&calls, user{ID: 1}, nil)
+
+	_, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	mr.Del("user:1")
+	_, err = GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), calls)
+
+	assert.NoError(t, c.Delete(ctx, "user:1"))
+	_, err = GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls)
+
+	assert.NoError(t, c.InvalidateTags(ctx, "users"))
+	_, err = GetOrLoadWith(ctx, c, "user:1", time.Minute, loader, "users")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls)
+}
+
+type failingBackend struct {
+	*MemoryBackend
+}
+
+func (failingBackend) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func TestGetOrLoadBackendError(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	var reported error
+	c := New(&Options{Backend: failingBackend{NewMemoryBackend()}, OnError: func(err error) { reported = err }})
+
+	var calls int32
+	u, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, countingLoader(&calls, user{ID: 1}, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, u.ID)
+	assert.EqualError(t, reported, "connection refused")
+}
+
+func TestGetOrLoadBackendErrorLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger})
+	c := New(&Options{Backend: failingBackend{NewMemoryBackend()}})
+
+	var calls int32
+	_, err := GetOrLoadWith(ctx, c, "user:1", time.Minute, countingLoader(&calls, user{ID: 1}, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "cache backend failed", hook.LastEntry().Message)
+}
@@ -0,0 +1,14 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+)
+
+func newRedisContext(t *testing.T) (bucharest.Context, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})}), mr
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/spf13/viper"
+)
+
+const usage = `usage:
+  bucharest-config dump [-secret pattern,...] <file|profile>
+  bucharest-config diff [-secret pattern,...] <file|profile> <file|profile>
+
+A profile name such as "staging" is read from ".env.staging".
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	secret := flags.String("secret", strings.Join(bucharest.DefaultSecretPatterns, ","), "comma separated key patterns to redact")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	patterns := strings.Split(*secret, ",")
+
+	switch {
+	case args[0] == "dump" && flags.NArg() == 1:
+		env, err := load(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return bucharest.WriteENVSettings(os.Stdout, bucharest.DumpENV(env, patterns...))
+	case args[0] == "diff" && flags.NArg() == 2:
+		left, err := load(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		right, err := load(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		return bucharest.WriteENVDiff(os.Stdout, bucharest.DiffENV(left, right, patterns...))
+	default:
+		return errors.New(usage)
+	}
+}
+
+func load(fileOrProfile string) (bucharest.ENV, error) {
+	filename := fileOrProfile
+	if _, err := os.Stat(filename); err != nil {
+		filename = ".env." + fileOrProfile
+		if _, err := os.Stat(filename); err != nil {
+			return nil, fmt.Errorf("%s is neither a file nor a profile", fileOrProfile)
+		}
+	}
+
+	env, err := bucharest.NewENVWithOptions(&bucharest.ENVOptions{Filename: filename, Viper: viper.New()})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", filename, err)
+	}
+	return env, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/argonlab-io/bucharest/migrations"
+)
+
+const usage = `usage: bucharest-migrate [flags] up [version] | down [steps] | status
+
+Connection settings are read from DB_* keys, see bucharest.OpenSQLFromENV.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("bucharest-migrate", flag.ContinueOnError)
+	envFile := flags.String("env", ".env", "env file with the connection settings")
+	dir := flags.String("dir", "migrations", "directory containing the migration files")
+	table := flags.String("table", migrations.DefaultTable, "table that records applied migrations")
+	dryRun := flags.Bool("dry-run", false, "print the migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 || flags.NArg() > 2 {
+		return errors.New(usage)
+	}
+
+	env, err := bucharest.NewENV(*envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	db, err := bucharest.OpenSQLFromENV(env, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{ENV: env, SQL: db})
+
+	migrator, err := migrations.New(os.DirFS(*dir), &migrations.Options{Table: *table, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+
+	var arg int64
+	if flags.NArg() == 2 {
+		arg, err = strconv.ParseInt(flags.Arg(1), 10, 64)
+		if err != nil {
+			return errors.New(usage)
+		}
+	}
+
+	switch flags.Arg(0) {
+	case "up":
+		applied, err := migrator.UpTo(ctx, arg)
+		report("applied", applied, *dryRun, true)
+		return err
+	case "down":
+		if arg == 0 {
+			arg = 1
+		}
+		reverted, err := migrator.Down(ctx, int(arg))
+		report("reverted", reverted, *dryRun, false)
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.ChecksumMismatch {
+				state = "modified"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+	}
+	return errors.New(usage)
+}
+
+func report(verb string, migrations []migrations.Migration, dryRun bool, up bool) {
+	if dryRun {
+		verb = "would have " + verb
+	}
+	for _, migration := range migrations {
+		fmt.Printf("%s %d_%s\n", verb, migration.Version, migration.Name)
+		if dryRun && up {
+			fmt.Println(migration.Up)
+		} else if dryRun {
+			fmt.Println(migration.Down)
+		}
+	}
+}
@@ -16,17 +16,45 @@ type Context interface {
 	ENV() ENV
 	GORM() *gorm.DB
 	Log() *logrus.Logger
+	ReadOnly() Context
 	Redis() *redis.Client
 	SQL() *sql.DB
+	SQLHandle() SQLHandle
 	SQLX() *sqlx.DB
+	SQLXHandle() SQLXHandle
 	SetValue(key, val interface{})
+	UniversalRedis() redis.UniversalClient
 	Update(option *ContextOptions)
 }
 
+// contextBase is implemented by the contexts of this package. It is not part
+// of Context so that other packages can still implement Context.
+type contextBase interface {
+	base() *BuchatrestContext
+}
+
+// SQLHandle is satisfied by both *sql.DB and *sql.Tx.
+type SQLHandle interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLXHandle is satisfied by both *sqlx.DB and *sqlx.Tx.
+type SQLXHandle interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+}
+
 var ErrNoENV = errors.New("ENV is not present in this context")
 var ErrNoGORM = errors.New("*gorm.DB is not present in this context")
 var ErrNoLogrus = errors.New("*logrus.Logger is not present in this context")
 var ErrNoRedis = errors.New("*redis.Client is not present in this context")
+var ErrNotRedisClient = errors.New("the Redis client of this context is a cluster, sentinel or ring client, use UniversalRedis()")
 var ErrNoSQL = errors.New("*sql.DB is not present in this context")
 var ErrNoSQLX = errors.New("*sqlx.DB is not present in this context")
 
@@ -2,11 +2,16 @@ package bucharest_test
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"testing"
 
 	. "github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestAddValuesToContext(t *testing.T) {
@@ -36,3 +41,51 @@ func TestAddValuesToContext(t *testing.T) {
 	assert.Equal(t, value1, ctx.Value(key1))
 	assert.Equal(t, value2, ctx.Value(key2))
 }
+
+// fakeContext implements Context outside of the package, like the fakes of
+// the applications that use it.
+type fakeContext struct {
+	context.Context
+}
+
+func (fakeContext) ENV() ENV                              { return nil }
+func (fakeContext) GORM() *gorm.DB                        { return nil }
+func (fakeContext) Log() *logrus.Logger                   { return nil }
+func (f fakeContext) ReadOnly() Context                   { return f }
+func (fakeContext) Redis() *redis.Client                  { return nil }
+func (fakeContext) SQL() *sql.DB                          { return nil }
+func (fakeContext) SQLHandle() SQLHandle                  { return nil }
+func (fakeContext) SQLX() *sqlx.DB                        { return nil }
+func (fakeContext) SQLXHandle() SQLXHandle                { return nil }
+func (fakeContext) SetValue(key, val interface{})         {}
+func (fakeContext) UniversalRedis() redis.UniversalClient { return nil }
+func (fakeContext) Update(option *ContextOptions)         {}
+
+func TestForeignContext(t *testing.T) {
+	var ctx Context = fakeContext{context.WithValue(context.Background(), RequestIDKey, "request-1")}
+	assert.False(t, InTx(ctx))
+	assert.False(t, HasRedis(ctx))
+	assert.Equal(t, "request-1", Logger(ctx).Data["request_id"])
+	assert.Equal(t, "request-1", RequestID(Detach(ctx)))
+	assert.ErrorIs(t, WithTx(ctx, func(Context) error { return nil }), ErrNoSQL)
+}
+
+type wrappedContext struct {
+	Context
+}
+
+func TestWrappedContext(t *testing.T) {
+	inner, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(t, WithTx(wrappedContext{inner}, func(txCtx Context) error {
+		assert.True(t, InTx(txCtx))
+		return nil
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(t, WithTx(NewMockContext(inner, mock), func(txCtx Context) error { return nil }))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,41 @@
+package bucharest
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Detach returns a Context with the dependencies, tenant, values and request
+// ID of ctx that is never cancelled and has no deadline, for work that outlives
+// the request such as sending an email. The detached context runs outside the
+// transaction of ctx, which ends with the request, and WithTx starts a new one.
+// Once the handler of a gin request returns, the detached context sees the
+// values the request had then.
+func Detach(ctx Context) Context {
+	detached := baseOf(ctx).derive(context.WithoutCancel(ctx))
+	if detached.tx != nil {
+		detached.gorm_ = detached.tx.pool
+		detached.tx = nil
+	}
+	return detached
+}
+
+// Go runs fn in a goroutine with Detach(ctx). The error fn returns and the
+// panic it raises are logged through Log, or the standard logger when ctx has
+// none, with the request ID.
+func Go(ctx Context, fn func(ctx Context) error) {
+	detached := Detach(ctx)
+	go func() {
+		logger := Logger(detached)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.WithFields(logrus.Fields{"panic": r, "stack": string(debug.Stack())}).Error("goroutine panicked")
+			}
+		}()
+		if err := fn(detached); err != nil {
+			logger.WithError(err).Error("goroutine failed")
+		}
+	}()
+}
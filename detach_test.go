@@ -0,0 +1,157 @@
+package bucharest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetach(t *testing.T) {
+	logger := logrus.New()
+	parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx := NewContextWithOptions(&ContextOptions{Parent: parent, Logrus: logger})
+	ctx.SetValue(RequestIDKey, "request-1")
+	ctx.SetValue("user", "alice")
+
+	detached := Detach(ctx)
+	cancel()
+	assert.Error(t, ctx.Err())
+	assert.NoError(t, detached.Err())
+	assert.Nil(t, detached.Done())
+	_, ok := detached.Deadline()
+	assert.False(t, ok)
+	assert.Same(t, logger, detached.Log())
+	assert.Equal(t, "request-1", RequestID(detached))
+	assert.Equal(t, "alice", detached.Value("user"))
+}
+
+func TestDetachInTransaction(t *testing.T) {
+	ctx, mock := newMockContext(t)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	var detached Context
+	assert.NoError(t, WithTx(ctx, func(txCtx Context) error {
+		detached = Detach(txCtx)
+		return nil
+	}))
+
+	assert.False(t, InTx(detached))
+	assert.Same(t, ctx.SQL(), detached.SQL())
+	assert.NoError(t, WithTx(detached, func(txCtx Context) error {
+		return txCtx.GORM().Exec("UPDATE foo SET bar = ?", 1).Error
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDetachGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := NewContextWithOptions(nil)
+	g := gin.New()
+	g.Use(NewGinHandlerFunc(ctx, AssignRequestID))
+
+	var detached []Context
+	g.GET("/", NewGinHandlerFunc(ctx, func(ctx HTTPContext) HTTPError {
+		ctx.Set("user", ctx.Query("user"))
+		detached = append(detached, Detach(ctx))
+		return nil
+	}))
+
+	for _, user := range []string{"alice", "bob"} {
+		req := httptest.NewRequest(http.MethodGet, "/?user="+user, nil)
+		req.Header.Set(RequestIDHeader, "request-"+user)
+		g.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, "request-alice", RequestID(detached[0]))
+	assert.Equal(t, "alice", detached[0].Value("user"))
+	assert.Equal(t, "request-bob", RequestID(detached[1]))
+	assert.Equal(t, "bob", detached[1].Value("user"))
+}
+
+func TestDetachDerivedFromGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, mock := newMockContext(t)
+	g := gin.New()
+	g.Use(NewGinHandlerFunc(ctx, AssignRequestID))
+
+	var detached []Context
+	g.GET("/", NewGinHandlerFunc(ctx, func(ctx HTTPContext) HTTPError {
+		ctx.Set("user", ctx.Query("user"))
+		child, cancel := context.WithCancel(ctx)
+		defer cancel()
+		detached = append(detached, Detach(WithParent(ctx, child)))
+		if err := WithTx(ctx, func(txCtx Context) error {
+			detached = append(detached, Detach(txCtx))
+			return nil
+		}); err != nil {
+			return NewInternalServerError(err)
+		}
+		return nil
+	}))
+
+	for _, user := range []string{"alice", "bob"} {
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		req := httptest.NewRequest(http.MethodGet, "/?user="+user, nil)
+		req.Header.Set(RequestIDHeader, "request-"+user)
+		g.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Len(t, detached, 4)
+	for i, user := range []string{"alice", "alice", "bob", "bob"} {
+		assert.Equal(t, "request-"+user, RequestID(detached[i]), i)
+		assert.Equal(t, user, detached[i].Value("user"), i)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGo(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	parent, cancel := context.WithCancel(context.Background())
+	ctx := NewContextWithOptions(&ContextOptions{Parent: parent, Logrus: logger})
+	ctx.SetValue(RequestIDKey, "request-1")
+
+	done := make(chan struct{})
+	Go(ctx, func(ctx Context) error {
+		defer close(done)
+		<-time.After(10 * time.Millisecond)
+		assert.NoError(t, ctx.Err())
+		return errors.New("mailer is down")
+	})
+	cancel()
+	<-done
+
+	panicked := make(chan struct{})
+	Go(ctx, func(ctx Context) error {
+		defer close(panicked)
+		panic("boom")
+	})
+	<-panicked
+
+	assert.Eventually(t, func() bool { return len(hook.AllEntries()) == 2 }, time.Second, time.Millisecond)
+	entries := hook.AllEntries()
+	failed, panics := entries[0], entries[1]
+	if failed.Message != "goroutine failed" {
+		failed, panics = panics, failed
+	}
+	assert.Equal(t, "goroutine failed", failed.Message)
+	assert.EqualError(t, failed.Data[logrus.ErrorKey].(error), "mailer is down")
+	assert.Equal(t, "request-1", failed.Data["request_id"])
+	assert.Equal(t, "goroutine panicked", panics.Message)
+	assert.Equal(t, "boom", panics.Data["panic"])
+	assert.Equal(t, "request-1", panics.Data["request_id"])
+}
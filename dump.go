@@ -0,0 +1,151 @@
+package bucharest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type ENVSource string
+
+const (
+	ENVSourceDefault    ENVSource = "default"
+	ENVSourceEnv        ENVSource = "env"
+	ENVSourceFile       ENVSource = "file"
+	ENVSourceSecretFile ENVSource = "secret file"
+)
+
+type ENVDiffStatus string
+
+const (
+	ENVDiffAdded   ENVDiffStatus = "added"
+	ENVDiffChanged ENVDiffStatus = "changed"
+	ENVDiffRemoved ENVDiffStatus = "removed"
+)
+
+var DefaultSecretPatterns = []string{"password", "passwd", "secret", "token", "credential", "private_key", "api_key", "dsn"}
+
+type ENVSetting struct {
+	Key      string
+	Value    string
+	Source   ENVSource
+	Redacted bool
+	raw      string
+}
+
+type ENVDiff struct {
+	Key    string
+	Status ENVDiffStatus
+	Left   ENVSetting
+	Right  ENVSetting
+}
+
+func DumpENV(e ENV, secretPatterns ...string) []ENVSetting {
+	if len(secretPatterns) == 0 {
+		secretPatterns = DefaultSecretPatterns
+	}
+
+	v := e.Viper()
+	prefix := ""
+	if e, ok := e.(*env); ok {
+		prefix = e.prefix
+	}
+
+	keys := make(map[string]struct{})
+	for key := range e.All() {
+		keys[key] = struct{}{}
+	}
+
+	settings := make([]ENVSetting, 0, len(keys))
+	for key := range keys {
+		setting := ENVSetting{Key: strings.ToUpper(key), raw: e.String(key)}
+		switch {
+		case !v.IsSet(prefix + key):
+			setting.Source = ENVSourceSecretFile
+		case os.Getenv(strings.ToUpper(prefix+key)) != "":
+			setting.Source = ENVSourceEnv
+		case v.InConfig(prefix + key):
+			setting.Source = ENVSourceFile
+		default:
+			setting.Source = ENVSourceDefault
+		}
+
+		setting.Redacted = e.IsSecret(key) || matchSecretPattern(key, secretPatterns)
+		setting.Value = setting.raw
+		if setting.Redacted {
+			setting.Value = RedactedValue
+		}
+		settings = append(settings, setting)
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+func DiffENV(left, right ENV, secretPatterns ...string) []ENVDiff {
+	leftSettings := make(map[string]ENVSetting)
+	for _, setting := range DumpENV(left, secretPatterns...) {
+		leftSettings[setting.Key] = setting
+	}
+	rightSettings := make(map[string]ENVSetting)
+	for _, setting := range DumpENV(right, secretPatterns...) {
+		rightSettings[setting.Key] = setting
+	}
+
+	diffs := make([]ENVDiff, 0)
+	for key, l := range leftSettings {
+		r, ok := rightSettings[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, ENVDiff{Key: key, Status: ENVDiffRemoved, Left: l})
+		case l.raw != r.raw:
+			diffs = append(diffs, ENVDiff{Key: key, Status: ENVDiffChanged, Left: l, Right: r})
+		}
+	}
+	for key, r := range rightSettings {
+		if _, ok := leftSettings[key]; !ok {
+			diffs = append(diffs, ENVDiff{Key: key, Status: ENVDiffAdded, Right: r})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs
+}
+
+func WriteENVSettings(w io.Writer, settings []ENVSetting) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, setting := range settings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", setting.Key, setting.Value, setting.Source)
+	}
+	return tw.Flush()
+}
+
+func WriteENVDiff(w io.Writer, diffs []ENVDiff) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSTATUS\tLEFT\tRIGHT")
+	for _, diff := range diffs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", diff.Key, diff.Status, formatENVDiffSide(diff.Left), formatENVDiffSide(diff.Right))
+	}
+	return tw.Flush()
+}
+
+func formatENVDiffSide(setting ENVSetting) string {
+	if setting.Source == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s)", setting.Value, setting.Source)
+}
+
+func matchSecretPattern(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range patterns {
+		if strings.Contains(key, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package bucharest_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/argonlab-io/bucharest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpENV(t *testing.T) {
+	t.Setenv("DUMP_TEST_FROM_ENV", "foo")
+	secretPath := writeTempENV(t, "hunter3")
+	path := writeTempENV(t, "DB_HOST=localhost\nDB_PASSWORD=hunter2\nDUMP_TEST_FROM_ENV=bar\nREDIS_AUTH_FILE="+secretPath)
+	v := viper.New()
+	v.SetDefault("DB_PORT", 5432)
+	env, err := NewENVWithOptions(&ENVOptions{Filename: path, Viper: v})
+	assert.NoError(t, err)
+
+	settings := DumpENV(env)
+	bySetting := make(map[string]ENVSetting)
+	for _, setting := range settings {
+		bySetting[setting.Key] = setting
+	}
+
+	assert.Equal(t, "DB_HOST", settings[0].Key)
+	assert.Equal(t, "localhost", bySetting["DB_HOST"].Value)
+	assert.Equal(t, ENVSourceFile, bySetting["DB_HOST"].Source)
+	assert.Equal(t, RedactedValue, bySetting["DB_PASSWORD"].Value)
+	assert.True(t, bySetting["DB_PASSWORD"].Redacted)
+	assert.Equal(t, RedactedValue, bySetting["REDIS_AUTH"].Value)
+	assert.Equal(t, ENVSourceSecretFile, bySetting["REDIS_AUTH"].Source)
+	assert.Equal(t, "5432", bySetting["DB_PORT"].Value)
+	assert.Equal(t, ENVSourceDefault, bySetting["DB_PORT"].Source)
+	assert.Equal(t, "foo", bySetting["DUMP_TEST_FROM_ENV"].Value)
+	assert.Equal(t, ENVSourceEnv, bySetting["DUMP_TEST_FROM_ENV"].Source)
+
+	settings = DumpENV(env, "host")
+	for _, setting := range settings {
+		assert.Equal(t, setting.Key == "DB_HOST" || setting.Key == "REDIS_AUTH", setting.Redacted)
+	}
+
+	out := &bytes.Buffer{}
+	err = WriteENVSettings(out, DumpENV(env))
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "DB_HOST")
+	assert.NotContains(t, out.String(), "hunter2")
+}
+
+func TestDiffENV(t *testing.T) {
+	left, err := NewENVWithOptions(&ENVOptions{
+		Filename: writeTempENV(t, "DB_HOST=localhost\nDB_PASSWORD=hunter2\nDEBUG=true\nSAME=1"),
+		Viper:    viper.New(),
+	})
+	assert.NoError(t, err)
+	right, err := NewENVWithOptions(&ENVOptions{
+		Filename: writeTempENV(t, "DB_HOST=db.internal\nDB_PASSWORD=hunter3\nREPLICAS=2\nSAME=1"),
+		Viper:    viper.New(),
+	})
+	assert.NoError(t, err)
+
+	diffs := DiffENV(left, right)
+	assert.Len(t, diffs, 4)
+	assert.Equal(t, "DB_HOST", diffs[0].Key)
+	assert.Equal(t, ENVDiffChanged, diffs[0].Status)
+	assert.Equal(t, "db.internal", diffs[0].Right.Value)
+	assert.Equal(t, "DB_PASSWORD", diffs[1].Key)
+	assert.Equal(t, ENVDiffChanged, diffs[1].Status)
+	assert.Equal(t, RedactedValue, diffs[1].Left.Value)
+	assert.Equal(t, ENVDiffRemoved, diffs[2].Status)
+	assert.Equal(t, ENVDiffAdded, diffs[3].Status)
+
+	out := &bytes.Buffer{}
+	err = WriteENVDiff(out, diffs)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), "hunter")
+	assert.Contains(t, out.String(), "REPLICAS")
+}
+
+func TestDumpSubENV(t *testing.T) {
+	path := writeTempENV(t, "DB_PRIMARY_HOST=primary\nDB_PRIMARY_PASSWORD=hunter2\nDB_REPLICA_HOST=replica")
+	env, err := NewENVWithOptions(&ENVOptions{Filename: path, Viper: viper.New()})
+	assert.NoError(t, err)
+
+	settings := DumpENV(env.Sub("DB_PRIMARY"))
+	assert.Len(t, settings, 2)
+	assert.Equal(t, "HOST", settings[0].Key)
+	assert.Equal(t, "primary", settings[0].Value)
+	assert.Equal(t, ENVSourceFile, settings[0].Source)
+	assert.Equal(t, RedactedValue, settings[1].Value)
+	assert.Equal(t, ENVSourceFile, settings[1].Source)
+}
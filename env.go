@@ -1,7 +1,16 @@
 package bucharest
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/argonlab-io/bucharest/utils"
 	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
@@ -9,37 +18,265 @@ type ENV interface {
 	All() map[string]any
 	Bool(key string) bool
 	Int(key string) int
+	IsSecret(key string) bool
 	String(key string) string
+	Sub(prefix string) ENV
+	Unmarshal(out any) error
 	Viper() *viper.Viper
 }
 
-type env struct{ preventDefaultPointer uuid.UUID }
+type ENVOptions struct {
+	Filename      string
+	EncryptionKey []byte
+	Viper         *viper.Viper
+}
+
+const RedactedValue = "[REDACTED]"
+const ENVEncryptionKey = "ENV_ENCRYPTION_KEY"
+
+const encryptedValuePrefix = "enc:"
+const fileKeySuffix = "_FILE"
+const maxInterpolationDepth = 16
+
+var ErrNoEncryptionKey = errors.New("found an encrypted value but no encryption key is configured")
+var ErrInterpolationDepth = errors.New("interpolation is nested too deep, check for reference cycles")
+
+var interpolationPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.]+)\}`)
+
+type env struct {
+	preventDefaultPointer uuid.UUID
+	viper_                *viper.Viper
+	encryptionKey         []byte
+	prefix                string
+}
 
 func (e *env) All() map[string]any {
-	return viper.AllSettings()
+	all := make(map[string]any)
+	for _, key := range e.keys() {
+		value, secret, _ := e.resolve(e.prefix+key, 0)
+		if secret {
+			all[key] = RedactedValue
+			continue
+		}
+		all[key] = value
+	}
+	return all
 }
 
 func (e *env) Bool(key string) bool {
-	return viper.GetBool(key)
+	return cast.ToBool(e.String(key))
 }
 
 func (e *env) Int(key string) int {
-	return viper.GetInt(key)
+	return cast.ToInt(e.String(key))
+}
+
+func (e *env) IsSecret(key string) bool {
+	_, secret, _ := e.resolve(e.prefix+key, 0)
+	return secret
 }
 
 func (e *env) String(key string) string {
-	return viper.GetString(key)
+	value, _, _ := e.resolve(e.prefix+key, 0)
+	return value
+}
+
+func (e *env) Sub(prefix string) ENV {
+	sub := *e
+	if prefix = strings.ToLower(strings.TrimSuffix(prefix, "_")); prefix != "" {
+		sub.prefix = e.prefix + prefix + "_"
+	}
+	return &sub
+}
+
+func (e *env) Unmarshal(out any) error {
+	keys := e.keys()
+	for _, variable := range os.Environ() {
+		key := strings.ToLower(strings.SplitN(variable, "=", 2)[0])
+		if strings.HasPrefix(key, e.prefix) {
+			keys = append(keys, strings.TrimPrefix(key, e.prefix))
+			if derived := strings.TrimSuffix(key, strings.ToLower(fileKeySuffix)); derived != key {
+				keys = append(keys, strings.TrimPrefix(derived, e.prefix))
+			}
+		}
+	}
+
+	values := make(map[string]any)
+	for _, key := range keys {
+		value, _, err := e.resolve(e.prefix+key, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.ToUpper(e.prefix+key), err)
+		}
+		values[key] = value
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(values)
 }
 
 func (e *env) Viper() *viper.Viper {
-	return viper.GetViper()
+	return e.viper_
+}
+
+func (e *env) keys() []string {
+	all := e.viper_.AllKeys()
+	seen := make(map[string]struct{}, len(all))
+	for _, key := range all {
+		seen[key] = struct{}{}
+	}
+	for _, key := range all {
+		derived := strings.TrimSuffix(key, strings.ToLower(fileKeySuffix))
+		if _, ok := seen[derived]; !ok && derived != key {
+			seen[derived] = struct{}{}
+			all = append(all, derived)
+		}
+	}
+
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		if strings.HasPrefix(key, e.prefix) && key != e.prefix {
+			keys = append(keys, strings.TrimPrefix(key, e.prefix))
+		}
+	}
+	return keys
+}
+
+func (e *env) resolve(key string, depth int) (value string, secret bool, err error) {
+	if depth > maxInterpolationDepth {
+		return "", false, ErrInterpolationDepth
+	}
+
+	value, secret, err = e.lookup(key)
+	if err != nil {
+		return "", secret, err
+	}
+	// only whole values are decrypted, so that "enc:" can appear in a plain
+	// value such as a URL
+	if strings.HasPrefix(value, encryptedValuePrefix) {
+		value, err = e.decrypt(strings.TrimPrefix(value, encryptedValuePrefix))
+		if err != nil {
+			return "", true, err
+		}
+		secret = true
+	}
+	if embedded, decrypted, err := e.decryptEmbedded(value); err != nil {
+		return "", true, err
+	} else if decrypted {
+		value, secret = embedded, true
+	}
+
+	value = interpolationPattern.ReplaceAllStringFunc(value, func(match string) string {
+		reference, referenceIsSecret, referenceErr := e.resolve(interpolationPattern.FindStringSubmatch(match)[1], depth+1)
+		if referenceErr != nil && err == nil {
+			err = referenceErr
+		}
+		secret = secret || referenceIsSecret
+		return reference
+	})
+	return value, secret, err
+}
+
+func (e *env) lookup(key string) (string, bool, error) {
+	if e.viper_.IsSet(key) {
+		return e.viper_.GetString(key), strings.EqualFold(key, ENVEncryptionKey), nil
+	}
+
+	path := e.viper_.GetString(key + fileKeySuffix)
+	if path == "" {
+		return "", false, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", true, err
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// decryptEmbedded decrypts the encrypted values of other keys found inside
+// value. The dotenv parser expands an unquoted or double quoted ${DB_PASSWORD}
+// as it reads the file, so the ciphertext lands in the value before resolve
+// sees it.
+func (e *env) decryptEmbedded(value string) (string, bool, error) {
+	if !strings.Contains(value, encryptedValuePrefix) {
+		return value, false, nil
+	}
+	decrypted := false
+	for _, key := range e.viper_.AllKeys() {
+		raw := e.viper_.GetString(key)
+		if len(raw) <= len(encryptedValuePrefix) || !strings.HasPrefix(raw, encryptedValuePrefix) || !strings.Contains(value, raw) {
+			continue
+		}
+		plaintext, err := e.decrypt(strings.TrimPrefix(raw, encryptedValuePrefix))
+		if err != nil {
+			return "", true, err
+		}
+		value = strings.ReplaceAll(value, raw, plaintext)
+		decrypted = true
+	}
+	return value, decrypted, nil
+}
+
+func (e *env) decrypt(ciphertext string) (string, error) {
+	if len(e.encryptionKey) == 0 {
+		return "", ErrNoEncryptionKey
+	}
+	plaintext, err := utils.NewDecoder(ciphertext).Open(e.encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (e *env) validate() error {
+	for _, key := range e.keys() {
+		if _, _, err := e.resolve(e.prefix+key, 0); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
 }
 
 func NewENV(filename string) (ENV, error) {
-	viper.New()
-	viper.SetConfigFile(filename)
-	viper.SetConfigType("env")
+	return NewENVWithOptions(&ENVOptions{Filename: filename})
+}
+
+func NewENVWithOptions(options *ENVOptions) (ENV, error) {
+	if options == nil {
+		options = &ENVOptions{}
+	}
+	if options.Viper == nil {
+		options.Viper = viper.GetViper()
+	}
+
+	v := options.Viper
+	v.AutomaticEnv()
+
+	e := &env{preventDefaultPointer: uuid.New(), viper_: v, encryptionKey: options.EncryptionKey}
+	if options.Filename != "" {
+		v.SetConfigFile(options.Filename)
+		v.SetConfigType("env")
+		if err := v.ReadInConfig(); err != nil {
+			return e, err
+		}
+	}
+
+	if len(e.encryptionKey) == 0 && v.GetString(ENVEncryptionKey) != "" {
+		key, err := utils.NewDecoder(v.GetString(ENVEncryptionKey)).Bytes()
+		if err != nil {
+			return e, err
+		}
+		e.encryptionKey = key
+	}
 
-	viper.AutomaticEnv()
-	return &env{preventDefaultPointer: uuid.New()}, viper.ReadInConfig()
+	return e, e.validate()
 }
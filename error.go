@@ -89,3 +89,35 @@ func NewInternalServerError(err error) HTTPError {
 		originalError: err,
 	}
 }
+
+func NewTooManyRequestsError(err error) HTTPError {
+	return &HttpError{
+		status:        http.StatusTooManyRequests,
+		Message:       err.Error(),
+		originalError: err,
+	}
+}
+
+func NewConflictError(err error) HTTPError {
+	return &HttpError{
+		status:        http.StatusConflict,
+		Message:       err.Error(),
+		originalError: err,
+	}
+}
+
+func NewRequestEntityTooLargeError(err error) HTTPError {
+	return &HttpError{
+		status:        http.StatusRequestEntityTooLarge,
+		Message:       err.Error(),
+		originalError: err,
+	}
+}
+
+func NewUnprocessableEntityError(err error) HTTPError {
+	return &HttpError{
+		status:        http.StatusUnprocessableEntity,
+		Message:       err.Error(),
+		originalError: err,
+	}
+}
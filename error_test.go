@@ -100,3 +100,20 @@ func TestInternalServerErrorWithSerializableError(t *testing.T) {
 	assert.Equal(t, message.(map[string]interface{})["foo"], "bar")
 	assert.Equal(t, valErr.Error(), fmt.Sprint(valErr))
 }
+
+func TestStatusErrors(t *testing.T) {
+	testErr := errors.New("slow down")
+	for status, newError := range map[int]func(error) HTTPError{
+		http.StatusConflict:              NewConflictError,
+		http.StatusUnprocessableEntity:   NewUnprocessableEntityError,
+		http.StatusTooManyRequests:       NewTooManyRequestsError,
+		http.StatusRequestEntityTooLarge: NewRequestEntityTooLargeError,
+	} {
+		httpError := newError(testErr)
+		assert.Equal(t, status, httpError.GetStatus())
+		assert.ErrorIs(t, httpError.OriginalError(), testErr)
+		mapper := make(map[string]interface{})
+		assert.NoError(t, utils.JSONMapper(httpError.GetJSON(), &mapper))
+		assert.Equal(t, "slow down", mapper["message"])
+	}
+}
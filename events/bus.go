@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/google/uuid"
+)
+
+// Named lets an event choose the name it travels under instead of its Go type,
+// so that it can be renamed or moved without breaking other replicas.
+type Named interface {
+	EventName() string
+}
+
+type Options struct {
+	// Transport carries the events to the other replicas, events stay in the
+	// process when it is nil.
+	Transport Transport
+	// OnError is called with the errors of asynchronous and remote deliveries.
+	// Without it they are logged with the event name.
+	OnError func(event string, err error)
+}
+
+type Bus struct {
+	options  *Options
+	origin   string
+	mu       sync.RWMutex
+	handlers map[string][]subscriber
+}
+
+type subscriber struct {
+	call   func(ctx bucharest.Context, event any) error
+	decode func(payload []byte) (any, error)
+}
+
+// envelope is what goes over the transport. Origin keeps a replica from
+// handling its own events twice.
+type envelope struct {
+	Origin  string          `json:"origin"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func New(options *Options) *Bus {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	return &Bus{options: o, origin: uuid.NewString(), handlers: make(map[string][]subscriber)}
+}
+
+func nameOf[E any]() string {
+	// A nil pointer would panic in an EventName with a value receiver, so
+	// pointer events are named from a zero value of their element.
+	var event any = *new(E)
+	if t := reflect.TypeOf((*E)(nil)).Elem(); t.Kind() == reflect.Pointer {
+		event = reflect.New(t.Elem()).Interface()
+	}
+	if named, ok := any(event).(Named); ok {
+		return named.EventName()
+	}
+	return reflect.TypeOf((*E)(nil)).Elem().String()
+}
+
+func Subscribe[E any](bus *Bus, handler func(ctx bucharest.Context, event E) error) {
+	name := nameOf[E]()
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers[name] = append(bus.handlers[name], subscriber{
+		call: func(ctx bucharest.Context, event any) error {
+			return handler(ctx, event.(E))
+		},
+		decode: func(payload []byte) (any, error) {
+			var event E
+			err := json.Unmarshal(payload, &event)
+			return event, err
+		},
+	})
+}
+
+// Publish runs the handlers of this process one after another and returns
+// their errors joined, then hands the event to the transport. Handlers on
+// other replicas run asynchronously and report to their own OnError.
+func Publish[E any](ctx bucharest.Context, bus *Bus, event E) error {
+	name := nameOf[E]()
+	err := bus.dispatch(ctx, name, event)
+	if transportErr := bus.send(ctx, name, event); transportErr != nil {
+		err = errors.Join(err, transportErr)
+	}
+	return err
+}
+
+// PublishAsync is Publish in the background. The handlers get a Context with
+// the dependencies and values of ctx that outlives it.
+func PublishAsync[E any](ctx bucharest.Context, bus *Bus, event E) {
+	name := nameOf[E]()
+	detached := bucharest.Detach(ctx)
+	go func() {
+		if err := Publish(detached, bus, event); err != nil {
+			bus.onError(detached, name, err)
+		}
+	}()
+}
+
+// Run delivers the events of the other replicas until ctx is done. It returns
+// at once when there is no transport.
+func (bus *Bus) Run(ctx bucharest.Context) error {
+	if bus.options.Transport == nil {
+		return nil
+	}
+	return bus.options.Transport.Subscribe(ctx, func(data []byte) {
+		var e envelope
+		if err := json.Unmarshal(data, &e); err != nil {
+			bus.onError(ctx, "", err)
+			return
+		}
+		if e.Origin == bus.origin {
+			return
+		}
+		bus.receive(ctx, e.Name, e.Payload)
+	})
+}
+
+func (bus *Bus) subscribers(name string) []subscriber {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	return bus.handlers[name]
+}
+
+func (bus *Bus) dispatch(ctx bucharest.Context, name string, event any) error {
+	var errs []error
+	for _, s := range bus.subscribers(name) {
+		if err := call(ctx, s, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (bus *Bus) receive(ctx bucharest.Context, name string, payload []byte) {
+	for _, s := range bus.subscribers(name) {
+		event, err := s.decode(payload)
+		if err == nil {
+			err = call(ctx, s, event)
+		}
+		if err != nil {
+			bus.onError(ctx, name, err)
+		}
+	}
+}
+
+func (bus *Bus) send(ctx context.Context, name string, event any) error {
+	if bus.options.Transport == nil {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(envelope{Origin: bus.origin, Name: name, Payload: payload})
+	if err != nil {
+		return err
+	}
+	return bus.options.Transport.Publish(ctx, data)
+}
+
+func (bus *Bus) onError(ctx bucharest.Context, event string, err error) {
+	if bus.options.OnError != nil {
+		bus.options.OnError(event, err)
+		return
+	}
+	bucharest.Logger(ctx).WithError(err).WithField("event", event).Error("event handler failed")
+}
+
+func call(ctx bucharest.Context, s subscriber, event any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event handler panicked: %v", r)
+		}
+	}()
+	return s.call(ctx, event)
+}
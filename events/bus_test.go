@@ -0,0 +1,135 @@
+package events_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/events"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type orderPlaced struct {
+	ID int `json:"id"`
+}
+
+type userSignedUp struct {
+	Email string `json:"email"`
+}
+
+func (userSignedUp) EventName() string {
+	return "user.signed_up"
+}
+
+func TestPublish(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	bus := New(nil)
+
+	var seen []string
+	Subscribe(bus, func(ctx bucharest.Context, e orderPlaced) error {
+		seen = append(seen, "first")
+		assert.Equal(t, 1, e.ID)
+		return nil
+	})
+	Subscribe(bus, func(ctx bucharest.Context, e orderPlaced) error {
+		seen = append(seen, "second")
+		return nil
+	})
+	Subscribe(bus, func(ctx bucharest.Context, e userSignedUp) error {
+		seen = append(seen, "other")
+		return nil
+	})
+
+	assert.NoError(t, Publish(ctx, bus, orderPlaced{ID: 1}))
+	assert.Equal(t, []string{"first", "second"}, seen)
+	assert.NoError(t, Publish(ctx, New(nil), orderPlaced{ID: 1}))
+}
+
+func TestPublishErrors(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	bus := New(nil)
+	failure := errors.New("inventory is down")
+	var calls int
+	Subscribe(bus, func(bucharest.Context, orderPlaced) error {
+		calls++
+		return failure
+	})
+	Subscribe(bus, func(bucharest.Context, orderPlaced) error {
+		calls++
+		panic("boom")
+	})
+	Subscribe(bus, func(bucharest.Context, orderPlaced) error {
+		calls++
+		return nil
+	})
+
+	err := Publish(ctx, bus, orderPlaced{ID: 1})
+	assert.ErrorIs(t, err, failure)
+	assert.ErrorContains(t, err, "event handler panicked: boom")
+	assert.Equal(t, 3, calls)
+}
+
+func TestPublishAsync(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	reported := make(chan error, 1)
+	bus := New(&Options{OnError: func(event string, err error) {
+		assert.Equal(t, "user.signed_up", event)
+		reported <- err
+	}})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var email string
+	Subscribe(bus, func(ctx bucharest.Context, e userSignedUp) error {
+		defer wg.Done()
+		email = e.Email
+		return errors.New("mailer is down")
+	})
+
+	PublishAsync(ctx, bus, userSignedUp{Email: "alice@example.com"})
+	wg.Wait()
+	assert.Equal(t, "alice@example.com", email)
+	select {
+	case err := <-reported:
+		assert.EqualError(t, err, "mailer is down")
+	case <-time.After(time.Second):
+		t.Fatal("the error was not reported")
+	}
+}
+
+func TestPointerEvents(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	bus := New(nil)
+
+	var email string
+	Subscribe(bus, func(ctx bucharest.Context, e *userSignedUp) error {
+		email = e.Email
+		return nil
+	})
+	assert.NoError(t, Publish(ctx, bus, &userSignedUp{Email: "alice@example.com"}))
+	assert.Equal(t, "alice@example.com", email)
+}
+
+func TestPublishAsyncErrorLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger})
+	ctx.SetValue(bucharest.RequestIDKey, "request-1")
+	bus := New(nil)
+	Subscribe(bus, func(bucharest.Context, orderPlaced) error {
+		return errors.New("warehouse is down")
+	})
+
+	PublishAsync(ctx, bus, orderPlaced{ID: 1})
+	assert.Eventually(t, func() bool { return len(hook.AllEntries()) == 1 }, time.Second, 5*time.Millisecond)
+	entry := hook.LastEntry()
+	assert.Equal(t, "event handler failed", entry.Message)
+	assert.Equal(t, "events_test.orderPlaced", entry.Data["event"])
+	assert.Equal(t, "request-1", entry.Data["request_id"])
+}
+
+func TestRunWithoutTransport(t *testing.T) {
+	assert.NoError(t, New(nil).Run(bucharest.NewContextWithOptions(nil)))
+}
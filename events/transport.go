@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultChannel = "events"
+const MaxStreamBackoff = time.Minute
+const DefaultStreamBlock = time.Second
+
+// Transport broadcasts events to every replica, including the one that
+// published them.
+type Transport interface {
+	Publish(ctx context.Context, data []byte) error
+	// Subscribe calls deliver with every event published from when it was
+	// called until ctx is done.
+	Subscribe(ctx context.Context, deliver func(data []byte)) error
+}
+
+// RedisPubSub delivers events to the replicas that are connected when they are
+// published, and drops them for the rest.
+type RedisPubSub struct {
+	Client  redis.UniversalClient
+	Channel string
+}
+
+func NewRedisPubSub(client redis.UniversalClient) *RedisPubSub {
+	return &RedisPubSub{Client: client, Channel: DefaultChannel}
+}
+
+func (t *RedisPubSub) Publish(ctx context.Context, data []byte) error {
+	return t.Client.Publish(ctx, t.Channel, data).Err()
+}
+
+func (t *RedisPubSub) Subscribe(ctx context.Context, deliver func(data []byte)) error {
+	pubsub := t.Client.Subscribe(ctx, t.Channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
+
+// RedisStream keeps the events in a stream capped at MaxLen entries. A replica
+// that loses its connection picks up where it left off once it is back, as
+// long as the events it missed were not trimmed.
+type RedisStream struct {
+	Client redis.UniversalClient
+	Stream string
+	MaxLen int64
+	// Block is how long a read waits for new events before checking ctx,
+	// DefaultStreamBlock when it is not positive.
+	Block time.Duration
+	// OnError is called with the read errors that Subscribe retries. Without
+	// it they are logged with the stream name, and with the request ID when
+	// ctx is a bucharest.Context.
+	OnError func(err error)
+}
+
+func NewRedisStream(client redis.UniversalClient) *RedisStream {
+	return &RedisStream{Client: client, Stream: DefaultChannel, MaxLen: 10000, Block: DefaultStreamBlock}
+}
+
+func (t *RedisStream) Publish(ctx context.Context, data []byte) error {
+	return t.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.Stream,
+		MaxLen: t.MaxLen,
+		Approx: true,
+		Values: map[string]any{"data": data},
+	}).Err()
+}
+
+// Subscribe retries a failed read from the last event it delivered, waiting
+// twice as long as the last time from Block up to MaxStreamBackoff.
+func (t *RedisStream) Subscribe(ctx context.Context, deliver func(data []byte)) error {
+	// Start after the newest entry rather than at "$", which would skip the
+	// events added between two reads.
+	last := "0-0"
+	newest, err := t.Client.XRevRangeN(ctx, t.Stream, "+", "-", 1).Result()
+	if err != nil {
+		return err
+	}
+	if len(newest) > 0 {
+		last = newest[0].ID
+	}
+
+	// A zero Block would make XREAD wait for ever and Subscribe miss ctx.
+	block := t.Block
+	if block <= 0 {
+		block = DefaultStreamBlock
+	}
+	wait := time.Duration(0)
+	for ctx.Err() == nil {
+		streams, err := t.Client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{t.Stream, last},
+			Block:   block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			t.onError(ctx, err)
+			wait = min(max(wait*2, block), max(MaxStreamBackoff, block))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			continue
+		}
+		wait = 0
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				last = msg.ID
+				if data, ok := msg.Values["data"].(string); ok {
+					deliver([]byte(data))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (t *RedisStream) onError(ctx context.Context, err error) {
+	if t.OnError != nil {
+		t.OnError(err)
+		return
+	}
+	entry := logrus.WithContext(ctx)
+	if bctx, ok := ctx.(bucharest.Context); ok {
+		entry = bucharest.Logger(bctx)
+	}
+	entry.WithError(err).WithField("stream", t.Stream).Error("event stream read failed")
+}
@@ -0,0 +1,160 @@
+package events_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/events"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTransport(t *testing.T, newTransport func(client redis.UniversalClient) Transport) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: client})
+	parent, cancel := context.WithCancel(ctx)
+	runCtx := bucharest.WithParent(ctx, parent)
+
+	publisher := New(&Options{Transport: newTransport(client)})
+	replica := New(&Options{Transport: newTransport(client)})
+	var local, remote int32
+	received := make(chan orderPlaced, 1)
+	Subscribe(publisher, func(bucharest.Context, orderPlaced) error {
+		atomic.AddInt32(&local, 1)
+		return nil
+	})
+	Subscribe(replica, func(ctx bucharest.Context, e orderPlaced) error {
+		atomic.AddInt32(&remote, 1)
+		assert.Same(t, client, ctx.Redis())
+		received <- e
+		return nil
+	})
+
+	done := make(chan struct{}, 2)
+	for _, bus := range []*Bus{publisher, replica} {
+		go func() {
+			assert.NoError(t, bus.Run(runCtx))
+			done <- struct{}{}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, Publish(ctx, publisher, orderPlaced{ID: 7}))
+	select {
+	case e := <-received:
+		assert.Equal(t, orderPlaced{ID: 7}, e)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the replica did not receive the event")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&local))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&remote))
+
+	cancel()
+	<-done
+	<-done
+}
+
+func TestRedisPubSub(t *testing.T) {
+	testTransport(t, func(client redis.UniversalClient) Transport {
+		return NewRedisPubSub(client)
+	})
+}
+
+func TestRedisStream(t *testing.T) {
+	testTransport(t, func(client redis.UniversalClient) Transport {
+		stream := NewRedisStream(client)
+		stream.Block = 20 * time.Millisecond
+		return stream
+	})
+}
+
+func TestRedisStreamRetriesFromLastEvent(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := NewRedisStream(client)
+	stream.Block = 10 * time.Millisecond
+	errs := make(chan error, 100)
+	stream.OnError = func(err error) { errs <- err }
+	received := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- stream.Subscribe(ctx, func(data []byte) { received <- string(data) })
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	assert.NoError(t, stream.Publish(ctx, []byte("first")))
+	assert.Equal(t, "first", <-received)
+
+	mr.SetError("LOADING")
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "LOADING")
+	case <-time.After(time.Second):
+		t.Fatal("the read error was not reported")
+	}
+	_, err := mr.XAdd(DefaultChannel, "*", []string{"data", "second"})
+	assert.NoError(t, err)
+	mr.SetError("")
+
+	select {
+	case data := <-received:
+		assert.Equal(t, "second", data)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the event added during the outage was not delivered")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, received)
+}
+
+type blockHook struct {
+	blocks chan any
+}
+
+func (h blockHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if args := cmd.Args(); cmd.Name() == "xread" && len(args) > 2 && args[1] == "block" {
+		h.blocks <- args[2]
+	}
+	return ctx, nil
+}
+
+func (blockHook) AfterProcess(context.Context, redis.Cmder) error { return nil }
+
+func (blockHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (blockHook) AfterProcessPipeline(context.Context, []redis.Cmder) error { return nil }
+
+func TestRedisStreamWithoutBlock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	hook := blockHook{blocks: make(chan any, 10)}
+	client.AddHook(hook)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// BLOCK 0 would wait for ever, so a literal without Block reads with
+	// DefaultStreamBlock.
+	stream := &RedisStream{Client: client, Stream: DefaultChannel}
+	done := make(chan error, 1)
+	go func() {
+		done <- stream.Subscribe(ctx, func([]byte) {})
+	}()
+	select {
+	case block := <-hook.blocks:
+		assert.Equal(t, DefaultStreamBlock.Milliseconds(), block)
+	case <-time.After(time.Second):
+		t.Fatal("the stream was not read")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
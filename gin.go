@@ -1,18 +1,26 @@
 package bucharest
 
 import (
+	"database/sql"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/gin-gonic/gin/render"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
+const scopedContextKey = "bucharest.scopedContext"
+const httpErrorKey = "bucharest.httpError"
+
 func defaultHttpContextWithGin(ctx Context, g *gin.Context) *httpContextWithGin {
 	return &httpContextWithGin{
 		Context:             ctx,
@@ -32,8 +40,12 @@ func defaultHttpContextWithGin(ctx Context, g *gin.Context) *httpContextWithGin
 
 func NewGinHandlerFunc(ctx Context, handlerFunc HandlerFunc) gin.HandlerFunc {
 	return func(g *gin.Context) {
-		httpError := handlerFunc(defaultHttpContextWithGin(ctx, g))
+		defer recoverUnscopedHandle(g)
+		h := defaultHttpContextWithGin(ctx, g)
+		defer h.end()
+		httpError := handlerFunc(h)
 		if httpError != nil {
+			g.Set(httpErrorKey, httpError)
 			g.JSON(httpError.GetStatus(), httpError.GetJSON())
 		}
 	}
@@ -41,16 +53,32 @@ func NewGinHandlerFunc(ctx Context, handlerFunc HandlerFunc) gin.HandlerFunc {
 
 func NewGinHandlerFuncWithData(ctx Context, handlerFunc HandlerFuncWithData, data map[string]any) gin.HandlerFunc {
 	return func(g *gin.Context) {
-		httpError := handlerFunc(defaultHttpContextWithGin(ctx, g), data)
+		defer recoverUnscopedHandle(g)
+		h := defaultHttpContextWithGin(ctx, g)
+		defer h.end()
+		httpError := handlerFunc(h, data)
 		if httpError != nil {
+			g.Set(httpErrorKey, httpError)
 			g.JSON(httpError.GetStatus(), httpError.GetJSON())
 		}
 	}
 }
 
+// scopeContext makes the dependencies of scoped visible to every handler that
+// runs for the rest of the request. Call the returned func to undo it.
+func scopeContext(ctx HTTPContext, scoped Context) func() {
+	previous, _ := ctx.Get(scopedContextKey)
+	ctx.Set(scopedContextKey, scoped)
+	return func() { ctx.Set(scopedContextKey, previous) }
+}
+
 type httpContextWithGin struct {
 	Context
 	gin *gin.Context
+	// ended is a copy of gin taken when the handler returns. gin reuses its
+	// context for another request then, so the contexts derived from this one
+	// look values up in the copy.
+	ended atomic.Pointer[gin.Context]
 	ginHandlerInfo
 	ginRequest
 	ginHandlerControl
@@ -469,6 +497,70 @@ func (rb *ginResponseBody) Stream(step func(w io.Writer) bool) bool {
 
 // begin bucharest.Context
 
+func (h *httpContextWithGin) end() {
+	h.ended.Store(h.gin.Copy())
+}
+
+// request returns the gin context of the request, or its copy once the
+// handler returned.
+func (h *httpContextWithGin) request() *gin.Context {
+	if ended := h.ended.Load(); ended != nil {
+		return ended
+	}
+	return h.gin
+}
+
+func (h *httpContextWithGin) scoped() Context {
+	if scoped, ok := h.request().Get(scopedContextKey); ok && scoped != nil {
+		return scoped.(Context)
+	}
+	return h.Context
+}
+
+func (h *httpContextWithGin) ENV() ENV {
+	return h.scoped().ENV()
+}
+
+func (h *httpContextWithGin) GORM() *gorm.DB {
+	return h.base().gorm(h)
+}
+
+func (h *httpContextWithGin) Log() *logrus.Logger {
+	return h.scoped().Log()
+}
+
+func (h *httpContextWithGin) ReadOnly() Context {
+	return h.base().readOnly(h)
+}
+
+func (h *httpContextWithGin) Redis() *redis.Client {
+	return h.scoped().Redis()
+}
+
+func (h *httpContextWithGin) UniversalRedis() redis.UniversalClient {
+	return h.scoped().UniversalRedis()
+}
+
+func (h *httpContextWithGin) SQL() *sql.DB {
+	return h.scoped().SQL()
+}
+
+func (h *httpContextWithGin) SQLHandle() SQLHandle {
+	return h.scoped().SQLHandle()
+}
+
+func (h *httpContextWithGin) SQLX() *sqlx.DB {
+	return h.scoped().SQLX()
+}
+
+func (h *httpContextWithGin) SQLXHandle() SQLXHandle {
+	return h.scoped().SQLXHandle()
+}
+
+func (h *httpContextWithGin) base() *BuchatrestContext {
+	return baseOf(h.scoped())
+}
+
 func (h *httpContextWithGin) Deadline() (deadline time.Time, ok bool) {
 	return h.Context.Deadline()
 }
@@ -484,7 +576,7 @@ func (h *httpContextWithGin) Err() error {
 // end bucharest.Context
 
 func (h *httpContextWithGin) Value(key interface{}) interface{} {
-	fromGin := h.gin.Value(key)
+	fromGin := h.request().Value(key)
 	if fromGin != nil {
 		return fromGin
 	}
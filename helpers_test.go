@@ -0,0 +1,27 @@
+package bucharest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockContext returns a Context whose SQL, SQLX and GORM share one sqlmock
+// connection that matches queries exactly.
+func newMockContext(t *testing.T) (Context, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	options, err := NewContextOptionsFromSQL(db, "pgx", &OpenOptions{Dialector: postgresDialector})
+	assert.NoError(t, err)
+	return NewContextWithOptions(options), mock
+}
+
+func newRedisContext(t *testing.T, parent context.Context) (Context, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return NewContextWithOptions(&ContextOptions{Parent: parent, Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})}), mr
+}
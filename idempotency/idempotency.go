@@ -0,0 +1,214 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/gin-gonic/gin"
+)
+
+const Header = "Idempotency-Key"
+const ReplayedHeader = "Idempotent-Replayed"
+
+const DefaultPrefix = "idempotency:"
+const DefaultTTL = 24 * time.Hour
+const DefaultLockTimeout = time.Minute
+const DefaultMaxBodySize = 1 << 20
+const MaxKeyLength = 255
+
+var ErrMissingKey = errors.New("the Idempotency-Key header is required")
+var ErrInvalidKey = errors.New("the Idempotency-Key header is too long")
+var ErrInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+var ErrKeyReused = errors.New("the Idempotency-Key was used for a different request")
+
+type Options struct {
+	// Store defaults to Redis when the context has a client and to a MemoryStore
+	// otherwise.
+	Store  Store
+	Prefix string
+	// TTL is how long a response is replayed for.
+	TTL time.Duration
+	// LockTimeout is how long a key stays in flight if its request never
+	// finishes, for example because the instance died.
+	LockTimeout time.Duration
+	// Required rejects unsafe requests without the header.
+	Required bool
+	// Scope separates the keys of different clients so that one client cannot
+	// replay another's response. It defaults to the client IP, set it to the
+	// user ID for clients that sign in.
+	Scope func(ctx bucharest.HTTPContext) string
+	// MaxBodySize caps the request bodies that are read to fingerprint them,
+	// larger ones are rejected with 413.
+	MaxBodySize int64
+	// OnError is called when a response cannot be saved after the handlers ran,
+	// in which case the key is not remembered. Left nil, the error is logged
+	// with the request ID.
+	OnError func(err error)
+}
+
+type middleware struct {
+	options *Options
+	memory  *MemoryStore
+}
+
+// Middleware makes POST, PUT, PATCH and DELETE requests that carry an
+// Idempotency-Key safe to retry. The first request with a key runs and its
+// response is stored, later ones get that response replayed. Responses with a
+// 5xx status are not stored so that the request can be retried, and the
+// Set-Cookie header is never stored.
+func Middleware(options *Options) bucharest.HandlerFunc {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Prefix == "" {
+		o.Prefix = DefaultPrefix
+	}
+	if o.TTL == 0 {
+		o.TTL = DefaultTTL
+	}
+	if o.LockTimeout == 0 {
+		o.LockTimeout = DefaultLockTimeout
+	}
+	if o.Scope == nil {
+		o.Scope = func(ctx bucharest.HTTPContext) string { return ctx.ClientIP() }
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = DefaultMaxBodySize
+	}
+	m := &middleware{options: o, memory: NewMemoryStore()}
+	return m.handle
+}
+
+func (m *middleware) handle(ctx bucharest.HTTPContext) bucharest.HTTPError {
+	request := ctx.Gin().Request
+	key := ctx.GetHeader(Header)
+	switch {
+	case request.Method != http.MethodPost && request.Method != http.MethodPut && request.Method != http.MethodPatch && request.Method != http.MethodDelete:
+		ctx.Next()
+		return nil
+	case key == "" && m.options.Required:
+		ctx.Abort()
+		return bucharest.NewBadRequestError(ErrMissingKey)
+	case key == "":
+		ctx.Next()
+		return nil
+	case len(key) > MaxKeyLength:
+		ctx.Abort()
+		return bucharest.NewBadRequestError(ErrInvalidKey)
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Gin().Writer, request.Body, m.options.MaxBodySize))
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		ctx.Abort()
+		return bucharest.NewRequestEntityTooLargeError(err)
+	}
+	if err != nil {
+		ctx.Abort()
+		return bucharest.NewBadRequestError(err)
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	storeKey := m.options.Prefix + m.options.Scope(ctx) + ":" + key
+	fingerprint := fingerprintOf(request, body)
+	store := m.store(ctx)
+
+	stored, reserved, err := store.Reserve(ctx, storeKey, &Record{Fingerprint: fingerprint, Pending: true}, m.options.LockTimeout)
+	if err != nil {
+		ctx.Abort()
+		return bucharest.NewInternalServerError(err)
+	}
+	if !reserved {
+		ctx.Abort()
+		switch {
+		case stored.Fingerprint != fingerprint:
+			return bucharest.NewUnprocessableEntityError(ErrKeyReused)
+		case stored.Pending:
+			return bucharest.NewConflictError(ErrInFlight)
+		}
+		replay(ctx.Gin(), stored)
+		return nil
+	}
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Gin().Writer}
+	ctx.Gin().Writer = recorder
+	saved := false
+	saveCtx := context.WithoutCancel(ctx)
+	defer func() {
+		if !saved {
+			store.Delete(saveCtx, storeKey)
+		}
+	}()
+
+	ctx.Next()
+	ctx.Gin().Writer = recorder.ResponseWriter
+	if recorder.Status() >= http.StatusInternalServerError {
+		return nil
+	}
+	record := &Record{
+		Fingerprint: fingerprint,
+		Status:      recorder.Status(),
+		Header:      recorder.Header().Clone(),
+		Body:        recorder.body.Bytes(),
+	}
+	record.Header.Del("Set-Cookie")
+	if err := store.Save(saveCtx, storeKey, record, m.options.TTL); err != nil {
+		if m.options.OnError != nil {
+			m.options.OnError(err)
+		} else {
+			bucharest.Logger(ctx).WithError(err).Error("idempotent response could not be saved")
+		}
+		return nil
+	}
+	saved = true
+	return nil
+}
+
+func (m *middleware) store(ctx bucharest.Context) Store {
+	if m.options.Store != nil {
+		return m.options.Store
+	}
+	if bucharest.HasRedis(ctx) {
+		return NewRedisStore(ctx.UniversalRedis())
+	}
+	return m.memory
+}
+
+func fingerprintOf(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(g *gin.Context, record *Record) {
+	header := g.Writer.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(ReplayedHeader, "true")
+	g.Writer.WriteHeader(record.Status)
+	g.Writer.Write(record.Body)
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
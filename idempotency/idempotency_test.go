@@ -0,0 +1,206 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/idempotency"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter(ctx bucharest.Context, options *Options, handler bucharest.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	middleware := bucharest.NewGinHandlerFunc(ctx, Middleware(options))
+	g.POST("/orders", middleware, bucharest.NewGinHandlerFunc(ctx, handler))
+	g.GET("/orders", middleware, bucharest.NewGinHandlerFunc(ctx, handler))
+	return g
+}
+
+func serve(g *gin.Engine, method, key, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	return res
+}
+
+func createOrder(calls *int32) bucharest.HandlerFunc {
+	return func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		n := atomic.AddInt32(calls, 1)
+		body, _ := ctx.GetRawData()
+		ctx.Header("X-Order", string(body))
+		ctx.JSON(http.StatusCreated, gin.H{"order": n})
+		return nil
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	var calls int32
+	g := newRouter(ctx, nil, createOrder(&calls))
+
+	first := serve(g, http.MethodPost, "abc", `{"item":1}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.JSONEq(t, `{"order":1}`, first.Body.String())
+	assert.Equal(t, `{"item":1}`, first.Header().Get("X-Order"))
+	assert.Empty(t, first.Header().Get(ReplayedHeader))
+	assert.Equal(t, DefaultTTL, mr.TTL(DefaultPrefix+"192.0.2.1:abc"))
+
+	replayed := serve(g, http.MethodPost, "abc", `{"item":1}`)
+	assert.Equal(t, http.StatusCreated, replayed.Code)
+	assert.JSONEq(t, `{"order":1}`, replayed.Body.String())
+	assert.Equal(t, `{"item":1}`, replayed.Header().Get("X-Order"))
+	assert.Equal(t, "true", replayed.Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(1), calls)
+
+	reused := serve(g, http.MethodPost, "abc", `{"item":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, int32(1), calls)
+
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "def", `{"item":1}`).Code)
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "", `{"item":1}`).Code)
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodGet, "abc", "").Code)
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	var calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := newRouter(bucharest.NewContextWithOptions(nil), nil, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		close(started)
+		<-release
+		return createOrder(&calls)(ctx)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(g, http.MethodPost, "abc", "{}") }()
+	<-started
+
+	assert.Equal(t, http.StatusConflict, serve(g, http.MethodPost, "abc", "{}").Code)
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestMiddlewareDoesNotStoreServerErrors(t *testing.T) {
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), nil, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return bucharest.NewInternalServerError(errors.New("database is down"))
+		}
+		ctx.JSON(http.StatusCreated, gin.H{})
+		return nil
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, serve(g, http.MethodPost, "abc", "{}").Code)
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "abc", "{}").Code)
+	res := serve(g, http.MethodPost, "abc", "{}")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "true", res.Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestMiddlewareReleasesKeyOnPanic(t *testing.T) {
+	store := NewMemoryStore()
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Store: store}, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		ctx.JSON(http.StatusCreated, gin.H{})
+		return nil
+	})
+
+	assert.Panics(t, func() { serve(g, http.MethodPost, "abc", "{}") })
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "abc", "{}").Code)
+}
+
+func TestMiddlewareRequired(t *testing.T) {
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Required: true}, createOrder(&calls))
+
+	assert.Equal(t, http.StatusBadRequest, serve(g, http.MethodPost, "", "{}").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(g, http.MethodPost, strings.Repeat("k", MaxKeyLength+1), "{}").Code)
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodGet, "", "").Code)
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestMiddlewareScope(t *testing.T) {
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{
+		Scope: func(ctx bucharest.HTTPContext) string { return ctx.GetHeader("X-User") },
+		TTL:   time.Minute,
+	}, createOrder(&calls))
+
+	assert.Empty(t, serve(g, http.MethodPost, "abc", "{}", "X-User", "1").Header().Get(ReplayedHeader))
+	assert.Empty(t, serve(g, http.MethodPost, "abc", "{}", "X-User", "2").Header().Get(ReplayedHeader))
+	assert.Equal(t, "true", serve(g, http.MethodPost, "abc", "{}", "X-User", "1").Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestMiddlewareScopesByClientIP(t *testing.T) {
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), nil, createOrder(&calls))
+
+	assert.Empty(t, serve(g, http.MethodPost, "abc", "{}").Header().Get(ReplayedHeader))
+	assert.Empty(t, serve(g, http.MethodPost, "abc", "{}", "X-Forwarded-For", "198.51.100.7").Header().Get(ReplayedHeader))
+	assert.Equal(t, "true", serve(g, http.MethodPost, "abc", "{}").Header().Get(ReplayedHeader))
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestMiddlewareDoesNotStoreCookies(t *testing.T) {
+	g := newRouter(bucharest.NewContextWithOptions(nil), nil, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		ctx.SetCookie("session", "secret", 0, "/", "", true, true)
+		ctx.JSON(http.StatusCreated, gin.H{})
+		return nil
+	})
+
+	assert.NotEmpty(t, serve(g, http.MethodPost, "abc", "{}").Header().Get("Set-Cookie"))
+	replayed := serve(g, http.MethodPost, "abc", "{}")
+	assert.Equal(t, "true", replayed.Header().Get(ReplayedHeader))
+	assert.Empty(t, replayed.Header().Get("Set-Cookie"))
+}
+
+func TestMiddlewareMaxBodySize(t *testing.T) {
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{MaxBodySize: 8}, createOrder(&calls))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(g, http.MethodPost, "abc", `{"item":1}`).Code)
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "abc", `{}`).Code)
+	assert.Equal(t, int32(1), calls)
+}
+
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Save(context.Context, string, *Record, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestMiddlewareSaveErrorLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	var calls int32
+	g := newRouter(bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger}), &Options{Store: failingStore{NewMemoryStore()}}, createOrder(&calls))
+
+	assert.Equal(t, http.StatusCreated, serve(g, http.MethodPost, "abc", "{}").Code)
+	assert.Equal(t, "idempotent response could not be saved", hook.LastEntry().Message)
+}
@@ -0,0 +1,158 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Record is what is kept for an idempotency key. It is pending while the first
+// request with the key is still being handled.
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Pending     bool        `json:"pending"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type Store interface {
+	// Reserve saves record under key unless the key is taken, in which case it
+	// returns the record that is there and false.
+	Reserve(ctx context.Context, key string, record *Record, ttl time.Duration) (*Record, bool, error)
+	Save(ctx context.Context, key string, record *Record, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+type RedisStore struct {
+	Client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, key string, record *Record, ttl time.Duration) (*Record, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		ok, err := s.Client.SetNX(ctx, key, data, ttl).Result()
+		if err != nil || ok {
+			return nil, ok, err
+		}
+		existing, err := s.Client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			// It expired in between, try again.
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		stored := &Record{}
+		if err := json.Unmarshal(existing, stored); err != nil {
+			return nil, false, err
+		}
+		return stored, false, nil
+	}
+}
+
+func (s *RedisStore) Save(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.Client.Del(ctx, key).Err()
+}
+
+const DefaultMaxMemoryRecords = 10000
+
+// MemoryStore keeps records in process, for tests and single instance apps.
+// Expired records are swept every sweepInterval writes, and once MaxRecords is
+// reached the record closest to expiring is evicted.
+type MemoryStore struct {
+	MaxRecords int
+
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	writes  int
+}
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+const sweepInterval = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{MaxRecords: DefaultMaxMemoryRecords, records: make(map[string]memoryRecord)}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, record *Record, ttl time.Duration) (*Record, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[key]; ok && now.Before(existing.expiresAt) {
+		stored := existing.record
+		return &stored, false, nil
+	}
+	s.put(key, record, now.Add(ttl), now)
+	return nil, true, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, key string, record *Record, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key, record, now.Add(ttl), now)
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) put(key string, record *Record, expiresAt, now time.Time) {
+	if s.writes++; s.writes%sweepInterval == 0 {
+		s.sweep(now)
+	}
+	if _, ok := s.records[key]; !ok && s.MaxRecords > 0 && len(s.records) >= s.MaxRecords {
+		s.sweep(now)
+		if len(s.records) >= s.MaxRecords {
+			s.evict()
+		}
+	}
+	s.records[key] = memoryRecord{record: *record, expiresAt: expiresAt}
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, record := range s.records {
+		if !now.Before(record.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
+
+func (s *MemoryStore) evict() {
+	var evicted string
+	var expiresAt time.Time
+	for key, record := range s.records {
+		if evicted == "" || record.expiresAt.Before(expiresAt) {
+			evicted, expiresAt = key, record.expiresAt
+		}
+	}
+	delete(s.records, evicted)
+}
@@ -0,0 +1,66 @@
+package idempotency_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/idempotency"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	for _, store := range []Store{NewMemoryStore(), NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))} {
+		_, reserved, err := store.Reserve(ctx, "key", &Record{Fingerprint: "a", Pending: true}, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+
+		stored, reserved, err := store.Reserve(ctx, "key", &Record{Fingerprint: "b", Pending: true}, time.Minute)
+		assert.NoError(t, err)
+		assert.False(t, reserved)
+		assert.Equal(t, &Record{Fingerprint: "a", Pending: true}, stored)
+
+		record := &Record{Fingerprint: "a", Status: http.StatusCreated, Header: http.Header{"X-Order": {"1"}}, Body: []byte("{}")}
+		assert.NoError(t, store.Save(ctx, "key", record, time.Minute))
+		stored, _, err = store.Reserve(ctx, "key", &Record{Fingerprint: "a", Pending: true}, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, record, stored)
+
+		assert.NoError(t, store.Delete(ctx, "key"))
+		_, reserved, err = store.Reserve(ctx, "key", &Record{Fingerprint: "b", Pending: true}, time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+	}
+}
+
+func TestMemoryStoreMaxRecords(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.MaxRecords = 2
+
+	assert.NoError(t, store.Save(ctx, "expired", &Record{Status: 1}, time.Millisecond))
+	assert.NoError(t, store.Save(ctx, "long", &Record{Status: 2}, time.Hour))
+	time.Sleep(5 * time.Millisecond)
+	_, reserved, err := store.Reserve(ctx, "short", &Record{Pending: true}, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	assert.NoError(t, store.Save(ctx, "short", &Record{Status: 3}, time.Minute))
+	assert.NoError(t, store.Save(ctx, "new", &Record{Status: 4}, time.Hour))
+
+	// The kept keys are checked first, as reserving a missing one evicts again.
+	for _, key := range []string{"long", "new"} {
+		_, reserved, err := store.Reserve(ctx, key, &Record{Pending: true}, time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, reserved, key)
+	}
+	for _, key := range []string{"short", "expired"} {
+		_, reserved, err := store.Reserve(ctx, key, &Record{Pending: true}, time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, reserved, key)
+	}
+}
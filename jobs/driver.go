@@ -0,0 +1,296 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Message struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	EnqueuedAt  time.Time       `json:"enqueued_at"`
+}
+
+// Driver stores the messages of each queue. A popped message is hidden from
+// other workers until its visibility timeout passes, after which it is handed
+// out again, so a job whose worker died is not lost.
+type Driver interface {
+	Push(ctx context.Context, msg *Message, runAt time.Time) error
+	// Pop claims the next due message of queue and counts it as an attempt, so
+	// that a job that keeps killing its worker still runs out of attempts. It
+	// returns nil if no message is due.
+	Pop(ctx context.Context, queue string, visibility time.Duration) (*Message, error)
+	Ack(ctx context.Context, msg *Message) error
+	// Retry releases a claimed message to run again at runAt.
+	Retry(ctx context.Context, msg *Message, runAt time.Time) error
+	// Dead moves a claimed message to the dead-letter queue.
+	Dead(ctx context.Context, msg *Message) error
+	DeadLetters(ctx context.Context, queue string) ([]*Message, error)
+}
+
+var popScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expired = redis.call("zrangebyscore", KEYS[2], "-inf", now)
+for _, id in ipairs(expired) do
+	redis.call("zrem", KEYS[2], id)
+	redis.call("zadd", KEYS[1], now, id)
+end
+local due = redis.call("zrangebyscore", KEYS[1], "-inf", now, "LIMIT", 0, 1)
+if #due == 0 then
+	return false
+end
+redis.call("zrem", KEYS[1], due[1])
+redis.call("zadd", KEYS[2], now + tonumber(ARGV[2]), due[1])
+local attempts = redis.call("hincrby", KEYS[4], due[1], 1)
+return {redis.call("hget", KEYS[3], due[1]), attempts}`)
+
+// RedisDriver keeps a queue in a sorted set of due message IDs, a sorted set of
+// claimed IDs scored by when their visibility runs out, a hash of the messages,
+// a hash of their attempts and a list of dead letters. The keys of a queue share a hash tag so that it
+// works on a Redis Cluster.
+type RedisDriver struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+func NewRedisDriver(client redis.UniversalClient) *RedisDriver {
+	return &RedisDriver{Client: client, Prefix: DefaultPrefix}
+}
+
+func (d *RedisDriver) key(queue, name string) string {
+	return d.Prefix + "{" + queue + "}:" + name
+}
+
+func (d *RedisDriver) Push(ctx context.Context, msg *Message, runAt time.Time) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = d.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, d.key(msg.Queue, "messages"), msg.ID, data)
+		pipe.ZAdd(ctx, d.key(msg.Queue, "scheduled"), &redis.Z{Score: float64(runAt.UnixMilli()), Member: msg.ID})
+		return nil
+	})
+	return err
+}
+
+func (d *RedisDriver) Pop(ctx context.Context, queue string, visibility time.Duration) (*Message, error) {
+	keys := []string{d.key(queue, "scheduled"), d.key(queue, "active"), d.key(queue, "messages"), d.key(queue, "attempts")}
+	values, err := popScript.Run(ctx, d.Client, keys, time.Now().UnixMilli(), visibility.Milliseconds()).Slice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := values[0].(string)
+	attempts, _ := values[1].(int64)
+	msg := &Message{}
+	if err := json.Unmarshal([]byte(data), msg); err != nil {
+		return nil, err
+	}
+	msg.Attempts = int(attempts)
+	return msg, nil
+}
+
+func (d *RedisDriver) Ack(ctx context.Context, msg *Message) error {
+	_, err := d.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, d.key(msg.Queue, "active"), msg.ID)
+		pipe.HDel(ctx, d.key(msg.Queue, "messages"), msg.ID)
+		pipe.HDel(ctx, d.key(msg.Queue, "attempts"), msg.ID)
+		return nil
+	})
+	return err
+}
+
+func (d *RedisDriver) Retry(ctx context.Context, msg *Message, runAt time.Time) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = d.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, d.key(msg.Queue, "active"), msg.ID)
+		pipe.HSet(ctx, d.key(msg.Queue, "messages"), msg.ID, data)
+		pipe.ZAdd(ctx, d.key(msg.Queue, "scheduled"), &redis.Z{Score: float64(runAt.UnixMilli()), Member: msg.ID})
+		return nil
+	})
+	return err
+}
+
+func (d *RedisDriver) Dead(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = d.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, d.key(msg.Queue, "active"), msg.ID)
+		pipe.HDel(ctx, d.key(msg.Queue, "messages"), msg.ID)
+		pipe.HDel(ctx, d.key(msg.Queue, "attempts"), msg.ID)
+		pipe.RPush(ctx, d.key(msg.Queue, "dead"), data)
+		return nil
+	})
+	return err
+}
+
+func (d *RedisDriver) DeadLetters(ctx context.Context, queue string) ([]*Message, error) {
+	values, err := d.Client.LRange(ctx, d.key(queue, "dead"), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, len(values))
+	for i, value := range values {
+		messages[i] = &Message{}
+		if err := json.Unmarshal([]byte(value), messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// MemoryDriver keeps the queues in process, for tests.
+type MemoryDriver struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	seq    int64
+}
+
+type memoryQueue struct {
+	messages  map[string]Message
+	scheduled map[string]memoryEntry
+	active    map[string]time.Time
+	dead      []Message
+}
+
+// memoryEntry orders messages that are due at the same time by when they were
+// scheduled.
+type memoryEntry struct {
+	runAt time.Time
+	seq   int64
+}
+
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{queues: make(map[string]*memoryQueue)}
+}
+
+func (d *MemoryDriver) queue(name string) *memoryQueue {
+	q, ok := d.queues[name]
+	if !ok {
+		q = &memoryQueue{
+			messages:  make(map[string]Message),
+			scheduled: make(map[string]memoryEntry),
+			active:    make(map[string]time.Time),
+		}
+		d.queues[name] = q
+	}
+	return q
+}
+
+func (d *MemoryDriver) schedule(q *memoryQueue, id string, runAt time.Time) {
+	d.seq++
+	q.scheduled[id] = memoryEntry{runAt: runAt, seq: d.seq}
+}
+
+func (d *MemoryDriver) Push(_ context.Context, msg *Message, runAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(msg.Queue)
+	q.messages[msg.ID] = *msg
+	d.schedule(q, msg.ID, runAt)
+	return nil
+}
+
+func (d *MemoryDriver) Pop(_ context.Context, queue string, visibility time.Duration) (*Message, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(queue)
+	now := time.Now()
+	for id, deadline := range q.active {
+		if !deadline.After(now) {
+			delete(q.active, id)
+			d.schedule(q, id, now)
+		}
+	}
+
+	due := make([]string, 0, len(q.scheduled))
+	for id, entry := range q.scheduled {
+		if !entry.runAt.After(now) {
+			due = append(due, id)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := q.scheduled[due[i]], q.scheduled[due[j]]
+		if !a.runAt.Equal(b.runAt) {
+			return a.runAt.Before(b.runAt)
+		}
+		return a.seq < b.seq
+	})
+
+	id := due[0]
+	delete(q.scheduled, id)
+	q.active[id] = now.Add(visibility)
+	msg := q.messages[id]
+	msg.Attempts++
+	q.messages[id] = msg
+	return &msg, nil
+}
+
+func (d *MemoryDriver) Ack(_ context.Context, msg *Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(msg.Queue)
+	delete(q.active, msg.ID)
+	delete(q.messages, msg.ID)
+	return nil
+}
+
+func (d *MemoryDriver) Retry(_ context.Context, msg *Message, runAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(msg.Queue)
+	delete(q.active, msg.ID)
+	q.messages[msg.ID] = *msg
+	d.schedule(q, msg.ID, runAt)
+	return nil
+}
+
+func (d *MemoryDriver) Dead(_ context.Context, msg *Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(msg.Queue)
+	delete(q.active, msg.ID)
+	delete(q.messages, msg.ID)
+	q.dead = append(q.dead, *msg)
+	return nil
+}
+
+func (d *MemoryDriver) DeadLetters(_ context.Context, queue string) ([]*Message, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q := d.queue(queue)
+	messages := make([]*Message, len(q.dead))
+	for i := range q.dead {
+		msg := q.dead[i]
+		messages[i] = &msg
+	}
+	return messages, nil
+}
+
+// Pending returns how many messages of queue are scheduled or claimed.
+func (d *MemoryDriver) Pending(queue string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue(queue).messages)
+}
@@ -0,0 +1,77 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/jobs"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func drivers(t *testing.T) map[string]Driver {
+	mr := miniredis.RunT(t)
+	return map[string]Driver{
+		"memory": NewMemoryDriver(),
+		"redis":  NewRedisDriver(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+}
+
+func TestDrivers(t *testing.T) {
+	ctx := context.Background()
+	for name, driver := range drivers(t) {
+		now := time.Now()
+		assert.NoError(t, driver.Push(ctx, &Message{ID: "b", Queue: "q", Type: "job"}, now.Add(-time.Second)))
+		assert.NoError(t, driver.Push(ctx, &Message{ID: "a", Queue: "q", Type: "job"}, now.Add(-2*time.Second)))
+		assert.NoError(t, driver.Push(ctx, &Message{ID: "later", Queue: "q", Type: "job"}, now.Add(time.Hour)))
+
+		msg, err := driver.Pop(ctx, "q", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", msg.ID, name)
+		assert.NoError(t, driver.Ack(ctx, msg))
+
+		msg, err = driver.Pop(ctx, "q", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", msg.ID, name)
+		assert.Equal(t, 1, msg.Attempts, name)
+		msg.LastError = "failed"
+		assert.NoError(t, driver.Retry(ctx, msg, now.Add(-time.Second)))
+
+		msg, err = driver.Pop(ctx, "q", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", msg.ID, name)
+		assert.Equal(t, 2, msg.Attempts, name)
+		assert.NoError(t, driver.Dead(ctx, msg))
+
+		msg, err = driver.Pop(ctx, "q", time.Minute)
+		assert.NoError(t, err)
+		assert.Nil(t, msg, name)
+
+		dead, err := driver.DeadLetters(ctx, "q")
+		assert.NoError(t, err)
+		assert.Len(t, dead, 1)
+		assert.Equal(t, "failed", dead[0].LastError)
+	}
+}
+
+func TestDriversRequeueAfterVisibilityTimeout(t *testing.T) {
+	ctx := context.Background()
+	for name, driver := range drivers(t) {
+		assert.NoError(t, driver.Push(ctx, &Message{ID: "a", Queue: "q", Type: "job"}, time.Now()))
+		msg, err := driver.Pop(ctx, "q", 20*time.Millisecond)
+		assert.NoError(t, err)
+		assert.NotNil(t, msg, name)
+
+		msg, err = driver.Pop(ctx, "q", 20*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Nil(t, msg, name)
+
+		time.Sleep(30 * time.Millisecond)
+		msg, err = driver.Pop(ctx, "q", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", msg.ID, name)
+		assert.Equal(t, 2, msg.Attempts, name)
+	}
+}
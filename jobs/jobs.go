@@ -0,0 +1,264 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultPrefix = "jobs:"
+const DefaultQueue = "default"
+const DefaultMaxAttempts = 10
+const DefaultConcurrency = 10
+const DefaultPollInterval = time.Second
+const DefaultVisibilityTimeout = 5 * time.Minute
+
+var ErrUnknownJob = errors.New("no job is registered under this name")
+var ErrAttemptsExhausted = errors.New("the job was claimed more times than it may be attempted, its workers may have died")
+var ErrTimeoutTooLong = errors.New("a job timeout cannot be longer than the visibility timeout")
+
+type Options struct {
+	// Driver defaults to Redis through the context's client.
+	Driver Driver
+	// Concurrency caps the jobs that run at once per queue, DefaultConcurrency
+	// for queues that are not listed.
+	Concurrency  map[string]int
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a popped job is hidden from other workers.
+	// It is also the default and the longest timeout of a job, so that a job is
+	// not handed out twice while it is still running.
+	VisibilityTimeout time.Duration
+	// Backoff is the delay before the given retry, ExponentialBackoff by default.
+	Backoff func(attempts int) time.Duration
+	// OnError is called with the failed jobs and the driver errors. Left nil,
+	// failures are logged with the job type, ID and attempts.
+	OnError func(msg *Message, err error)
+}
+
+type JobOptions struct {
+	Queue       string
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+type Manager struct {
+	options *Options
+	mu      sync.RWMutex
+	jobs    map[string]*registration
+}
+
+type registration struct {
+	options *JobOptions
+	run     func(ctx bucharest.Context, payload json.RawMessage) error
+}
+
+// Job enqueues payloads of type T for the handler it was registered with.
+type Job[T any] struct {
+	manager *Manager
+	name    string
+	options *JobOptions
+}
+
+func New(options *Options) *Manager {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.VisibilityTimeout == 0 {
+		o.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if o.Backoff == nil {
+		o.Backoff = ExponentialBackoff
+	}
+	return &Manager{options: o, jobs: make(map[string]*registration)}
+}
+
+// ExponentialBackoff waits 2^attempts seconds, capped at an hour.
+func ExponentialBackoff(attempts int) time.Duration {
+	return min(time.Second<<min(attempts, 12), time.Hour)
+}
+
+// Register adds the handler of the jobs called name. Register every job before
+// calling Run. It panics with ErrTimeoutTooLong when the timeout of the job is
+// longer than the VisibilityTimeout of m.
+func Register[T any](m *Manager, name string, handler func(ctx bucharest.Context, payload T) error, options *JobOptions) *Job[T] {
+	o := &JobOptions{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Queue == "" {
+		o.Queue = DefaultQueue
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.Timeout == 0 {
+		o.Timeout = m.options.VisibilityTimeout
+	}
+	if o.Timeout > m.options.VisibilityTimeout {
+		panic(ErrTimeoutTooLong)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[name] = &registration{
+		options: o,
+		run: func(ctx bucharest.Context, raw json.RawMessage) error {
+			var payload T
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				return err
+			}
+			return handler(ctx, payload)
+		},
+	}
+	return &Job[T]{manager: m, name: name, options: o}
+}
+
+func (j *Job[T]) Enqueue(ctx bucharest.Context, payload T) (string, error) {
+	return j.EnqueueAt(ctx, time.Now(), payload)
+}
+
+func (j *Job[T]) EnqueueIn(ctx bucharest.Context, delay time.Duration, payload T) (string, error) {
+	return j.EnqueueAt(ctx, time.Now().Add(delay), payload)
+}
+
+func (j *Job[T]) EnqueueAt(ctx bucharest.Context, runAt time.Time, payload T) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	msg := &Message{
+		ID:          uuid.NewString(),
+		Queue:       j.options.Queue,
+		Type:        j.name,
+		Payload:     raw,
+		MaxAttempts: j.options.MaxAttempts,
+		EnqueuedAt:  time.Now().UTC(),
+	}
+	return msg.ID, j.manager.driver(ctx).Push(ctx, msg, runAt)
+}
+
+func (m *Manager) DeadLetters(ctx bucharest.Context, queue string) ([]*Message, error) {
+	return m.driver(ctx).DeadLetters(ctx, queue)
+}
+
+// Run works the queues of the registered jobs until ctx is done, then waits for
+// the jobs that are running. Jobs get a Context with the dependencies of ctx
+// that is not cancelled by it, only by their timeout.
+func (m *Manager) Run(ctx bucharest.Context) error {
+	m.mu.RLock()
+	queues := make(map[string]struct{})
+	for _, job := range m.jobs {
+		queues[job.options.Queue] = struct{}{}
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for queue := range queues {
+		concurrency, ok := m.options.Concurrency[queue]
+		if !ok {
+			concurrency = DefaultConcurrency
+		}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.work(ctx, queue)
+			}()
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+func (m *Manager) work(ctx bucharest.Context, queue string) {
+	driver := m.driver(ctx)
+	for ctx.Err() == nil {
+		msg, err := driver.Pop(ctx, queue, m.options.VisibilityTimeout)
+		if err != nil && ctx.Err() == nil {
+			m.onError(ctx, &Message{Queue: queue}, err)
+		}
+		if msg == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(m.options.PollInterval):
+			}
+			continue
+		}
+		m.process(ctx, driver, msg)
+	}
+}
+
+func (m *Manager) process(ctx bucharest.Context, driver Driver, msg *Message) {
+	jobCtx := context.WithoutCancel(ctx)
+	m.mu.RLock()
+	job, ok := m.jobs[msg.Type]
+	m.mu.RUnlock()
+	if !ok || msg.Attempts > msg.MaxAttempts {
+		err := fmt.Errorf("%w: %s", ErrUnknownJob, msg.Type)
+		if ok {
+			err = ErrAttemptsExhausted
+		}
+		msg.LastError = err.Error()
+		m.onError(ctx, msg, err)
+		if err := driver.Dead(jobCtx, msg); err != nil {
+			m.onError(ctx, msg, err)
+		}
+		return
+	}
+
+	err := m.run(bucharest.WithParent(ctx, jobCtx), job, msg)
+	if err == nil {
+		if err := driver.Ack(jobCtx, msg); err != nil {
+			m.onError(ctx, msg, err)
+		}
+		return
+	}
+
+	msg.LastError = err.Error()
+	m.onError(ctx, msg, err)
+	if msg.Attempts >= msg.MaxAttempts {
+		err = driver.Dead(jobCtx, msg)
+	} else {
+		err = driver.Retry(jobCtx, msg, time.Now().Add(m.options.Backoff(msg.Attempts)))
+	}
+	if err != nil {
+		m.onError(ctx, msg, err)
+	}
+}
+
+func (m *Manager) onError(ctx bucharest.Context, msg *Message, err error) {
+	if m.options.OnError != nil {
+		m.options.OnError(msg, err)
+		return
+	}
+	bucharest.Logger(ctx).WithError(err).WithFields(logrus.Fields{"job": msg.Type, "id": msg.ID, "attempts": msg.Attempts}).Error("job failed")
+}
+
+func (m *Manager) run(ctx bucharest.Context, job *registration, msg *Message) (err error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, job.options.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.run(bucharest.WithParent(ctx, timeoutCtx), msg.Payload)
+}
+
+func (m *Manager) driver(ctx bucharest.Context) Driver {
+	if m.options.Driver != nil {
+		return m.options.Driver
+	}
+	return NewRedisDriver(ctx.UniversalRedis())
+}
@@ -0,0 +1,257 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/jobs"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type email struct {
+	To string `json:"to"`
+}
+
+func runManager(t *testing.T, ctx bucharest.Context, m *Manager) (bucharest.Context, func()) {
+	parent, cancel := context.WithCancel(ctx)
+	runCtx := bucharest.WithParent(ctx, parent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, m.Run(runCtx))
+	}()
+	return runCtx, func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: client})
+	m := New(&Options{PollInterval: 5 * time.Millisecond})
+
+	sent := make(chan string, 1)
+	var seenRedis redis.UniversalClient
+	send := Register(m, "email", func(ctx bucharest.Context, payload email) error {
+		seenRedis = ctx.UniversalRedis()
+		sent <- payload.To
+		return nil
+	}, nil)
+
+	_, stop := runManager(t, ctx, m)
+	defer stop()
+	id, err := send.Enqueue(ctx, email{To: "alice@example.com"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	select {
+	case to := <-sent:
+		assert.Equal(t, "alice@example.com", to)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job did not run")
+	}
+	assert.Same(t, client, seenRedis)
+	waitFor(t, func() bool { return !mr.Exists(DefaultPrefix + "{default}:messages") })
+}
+
+func TestJobDelayed(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	m := New(&Options{Driver: NewMemoryDriver(), PollInterval: 5 * time.Millisecond})
+	var ranAt atomic.Value
+	job := Register(m, "report", func(bucharest.Context, struct{}) error {
+		ranAt.Store(time.Now())
+		return nil
+	}, nil)
+
+	_, stop := runManager(t, ctx, m)
+	defer stop()
+	enqueuedAt := time.Now()
+	_, err := job.EnqueueIn(ctx, 100*time.Millisecond, struct{}{})
+	assert.NoError(t, err)
+
+	waitFor(t, func() bool { return ranAt.Load() != nil })
+	assert.GreaterOrEqual(t, ranAt.Load().(time.Time).Sub(enqueuedAt), 100*time.Millisecond)
+}
+
+func TestJobRetriesAndDeadLetters(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	var failures []int
+	var mu sync.Mutex
+	m := New(&Options{
+		Driver:       NewMemoryDriver(),
+		PollInterval: 5 * time.Millisecond,
+		Backoff:      func(int) time.Duration { return 0 },
+		OnError: func(msg *Message, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, msg.Attempts)
+		},
+	})
+	var calls int32
+	job := Register(m, "flaky", func(ctx bucharest.Context, payload int) error {
+		atomic.AddInt32(&calls, 1)
+		if payload == 1 {
+			panic("boom")
+		}
+		return errors.New("unavailable")
+	}, &JobOptions{Queue: "critical", MaxAttempts: 3})
+
+	_, stop := runManager(t, ctx, m)
+	defer stop()
+	_, err := job.Enqueue(ctx, 0)
+	assert.NoError(t, err)
+
+	var dead []*Message
+	waitFor(t, func() bool {
+		dead, _ = m.DeadLetters(ctx, "critical")
+		return len(dead) == 1
+	})
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "unavailable", dead[0].LastError)
+	mu.Lock()
+	assert.Equal(t, []int{1, 2, 3}, failures)
+	mu.Unlock()
+
+	_, err = job.Enqueue(ctx, 1)
+	assert.NoError(t, err)
+	waitFor(t, func() bool {
+		dead, _ = m.DeadLetters(ctx, "critical")
+		return len(dead) == 2
+	})
+	assert.Equal(t, "job panicked: boom", dead[1].LastError)
+}
+
+func TestJobConcurrency(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	m := New(&Options{Driver: NewMemoryDriver(), PollInterval: 5 * time.Millisecond, Concurrency: map[string]int{DefaultQueue: 2}})
+	var running, peak, done int32
+	job := Register(m, "slow", func(bucharest.Context, struct{}) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+		return nil
+	}, nil)
+
+	for i := 0; i < 6; i++ {
+		_, err := job.Enqueue(ctx, struct{}{})
+		assert.NoError(t, err)
+	}
+	_, stop := runManager(t, ctx, m)
+	defer stop()
+	waitFor(t, func() bool { return atomic.LoadInt32(&done) == 6 })
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestJobTimeoutAndShutdown(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	m := New(&Options{Driver: NewMemoryDriver(), PollInterval: 5 * time.Millisecond})
+	started := make(chan struct{})
+	var jobErr atomic.Value
+	job := Register(m, "long", func(ctx bucharest.Context, _ struct{}) error {
+		close(started)
+		<-ctx.Done()
+		jobErr.Store(ctx.Err())
+		return nil
+	}, &JobOptions{Timeout: 50 * time.Millisecond})
+
+	_, err := job.Enqueue(ctx, struct{}{})
+	assert.NoError(t, err)
+	_, stop := runManager(t, ctx, m)
+	<-started
+	stop()
+	assert.ErrorIs(t, jobErr.Load().(error), context.DeadlineExceeded)
+}
+
+func TestUnknownJob(t *testing.T) {
+	ctx := bucharest.NewContextWithOptions(nil)
+	driver := NewMemoryDriver()
+	producer := New(&Options{Driver: driver})
+	job := Register(producer, "removed", func(bucharest.Context, struct{}) error { return nil }, nil)
+	_, err := job.Enqueue(ctx, struct{}{})
+	assert.NoError(t, err)
+
+	consumer := New(&Options{Driver: driver, PollInterval: 5 * time.Millisecond, OnError: func(*Message, error) {}})
+	Register(consumer, "other", func(bucharest.Context, struct{}) error { return nil }, nil)
+	_, stop := runManager(t, ctx, consumer)
+	defer stop()
+	waitFor(t, func() bool {
+		dead, _ := consumer.DeadLetters(ctx, DefaultQueue)
+		return len(dead) == 1
+	})
+}
+
+func TestJobAttemptsCountedWhenPopped(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger})
+	driver := NewMemoryDriver()
+	m := New(&Options{Driver: driver, PollInterval: 5 * time.Millisecond, VisibilityTimeout: 20 * time.Millisecond})
+	var calls int32
+	job := Register(m, "crashing", func(bucharest.Context, struct{}) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, &JobOptions{MaxAttempts: 1})
+	_, err := job.Enqueue(ctx, struct{}{})
+	assert.NoError(t, err)
+
+	// A worker that died while running the job never acked it.
+	msg, err := driver.Pop(ctx, DefaultQueue, 20*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, msg.Attempts)
+	time.Sleep(30 * time.Millisecond)
+
+	_, stop := runManager(t, ctx, m)
+	defer stop()
+	var dead []*Message
+	waitFor(t, func() bool {
+		dead, _ = m.DeadLetters(ctx, DefaultQueue)
+		return len(dead) == 1
+	})
+	assert.Zero(t, atomic.LoadInt32(&calls))
+	assert.Equal(t, 2, dead[0].Attempts)
+	assert.Equal(t, ErrAttemptsExhausted.Error(), dead[0].LastError)
+	assert.Equal(t, "job failed", hook.LastEntry().Message)
+	assert.Equal(t, "crashing", hook.LastEntry().Data["job"])
+}
+
+func TestRegisterTimeoutTooLong(t *testing.T) {
+	m := New(&Options{Driver: NewMemoryDriver(), VisibilityTimeout: time.Minute})
+	utils.AssertPanic(t, func() {
+		Register(m, "long", func(bucharest.Context, struct{}) error { return nil }, &JobOptions{Timeout: time.Hour})
+	}, ErrTimeoutTooLong)
+	Register(m, "short", func(bucharest.Context, struct{}) error { return nil }, &JobOptions{Timeout: time.Minute})
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, ExponentialBackoff(1))
+	assert.Equal(t, 8*time.Second, ExponentialBackoff(3))
+	assert.Equal(t, time.Hour, ExponentialBackoff(20))
+}
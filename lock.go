@@ -0,0 +1,193 @@
+package bucharest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const LockKeyPrefix = "bucharest:lock:"
+
+var ErrLockHeld = errors.New("the lock is held by another owner")
+var ErrLockLost = errors.New("the lock expired or was taken over")
+var ErrInvalidLockTTL = errors.New("the lock TTL must be at least a millisecond")
+
+var extendLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// RedisLock is a lock acquired with Lock. It extends itself every third of its
+// TTL until Unlock is called or an extension finds it gone.
+type RedisLock struct {
+	client redis.UniversalClient
+	key    string
+	token  int64
+	ttl    time.Duration
+
+	stop     context.CancelFunc
+	stopped  chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// Lock acquires the lock called name, or returns ErrLockHeld if another owner
+// has it. Every acquisition gets a fencing token that is larger than the one
+// before, so writes guarded by the lock can reject a stale owner's token. A
+// ttl under a millisecond is rejected with ErrInvalidLockTTL, as Redis expires
+// keys in whole milliseconds.
+func Lock(ctx Context, name string, ttl time.Duration) (*RedisLock, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidLockTTL
+	}
+	client := ctx.UniversalRedis()
+	key := LockKeyPrefix + name
+	token, err := client.Incr(ctx, key+":fence").Result()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	extendCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	lock := &RedisLock{
+		client:  client,
+		key:     key,
+		token:   token,
+		ttl:     ttl,
+		stop:    stop,
+		stopped: make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	go lock.keepAlive(extendCtx)
+	return lock, nil
+}
+
+func (l *RedisLock) Token() int64 {
+	return l.token
+}
+
+// Lost is closed when the lock can no longer be extended.
+func (l *RedisLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *RedisLock) Extend(ctx context.Context) error {
+	extended, err := extendLockScript.Run(ctx, l.client, []string{l.key}, strconv.FormatInt(l.token, 10), l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		l.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Unlock stops extending the lock and releases it if it still belongs to this
+// owner. It returns ErrLockLost otherwise.
+func (l *RedisLock) Unlock(ctx context.Context) error {
+	l.stop()
+	<-l.stopped
+	released, err := releaseLockScript.Run(ctx, l.client, []string{l.key}, strconv.FormatInt(l.token, 10)).Int()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		l.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *RedisLock) keepAlive(ctx context.Context) {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	extendedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := l.Extend(ctx)
+		switch {
+		case err == nil:
+			extendedAt = time.Now()
+		case errors.Is(err, ErrLockLost):
+			return
+		case time.Since(extendedAt) >= l.ttl:
+			l.markLost()
+			return
+		}
+	}
+}
+
+func (l *RedisLock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// Lead campaigns for the lock called name until ctx is done and calls fn each
+// time this instance wins it. The context passed to fn is cancelled when the
+// lock is lost or ctx is done, and fn should return then. Lead returns nil once
+// ctx is done, or the error fn returned while it still held the lock.
+func Lead(ctx Context, name string, ttl time.Duration, fn func(ctx Context) error) error {
+	if ttl < time.Millisecond {
+		return ErrInvalidLockTTL
+	}
+	for {
+		lock, err := Lock(ctx, name, ttl)
+		switch {
+		case err == nil:
+			if err := lead(ctx, lock, fn); err != nil {
+				return err
+			}
+		case !errors.Is(err, ErrLockHeld) && ctx.Err() == nil:
+			baseOf(ctx).logger().WithError(err).WithField("lock", name).Warn("leader election failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(ttl / 3):
+		}
+	}
+}
+
+func lead(ctx Context, lock *RedisLock, fn func(ctx Context) error) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-leaderCtx.Done():
+		}
+	}()
+
+	err := fn(baseOf(ctx).derive(leaderCtx))
+	lock.Unlock(context.WithoutCancel(ctx))
+	if err != nil && leaderCtx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package bucharest_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/argonlab-io/bucharest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	ctx, mr := newRedisContext(t, nil)
+
+	lock, err := Lock(ctx, "report", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), lock.Token())
+	value, _ := mr.Get(LockKeyPrefix + "report")
+	assert.Equal(t, "1", value)
+	assert.Equal(t, time.Minute, mr.TTL(LockKeyPrefix+"report"))
+
+	_, err = Lock(ctx, "report", time.Minute)
+	assert.ErrorIs(t, err, ErrLockHeld)
+
+	assert.NoError(t, lock.Unlock(ctx))
+	assert.False(t, mr.Exists(LockKeyPrefix+"report"))
+
+	lock, err = Lock(ctx, "report", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), lock.Token())
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func TestLockInvalidTTL(t *testing.T) {
+	ctx, mr := newRedisContext(t, nil)
+
+	for _, ttl := range []time.Duration{0, -time.Second, 500 * time.Microsecond} {
+		_, err := Lock(ctx, "report", ttl)
+		assert.ErrorIs(t, err, ErrInvalidLockTTL)
+	}
+	assert.ErrorIs(t, Lead(ctx, "report", 0, func(Context) error { return nil }), ErrInvalidLockTTL)
+	assert.False(t, mr.Exists(LockKeyPrefix+"report:fence"))
+	assert.False(t, mr.Exists(LockKeyPrefix+"report"))
+}
+
+func TestLockExtends(t *testing.T) {
+	ctx, mr := newRedisContext(t, nil)
+
+	lock, err := Lock(ctx, "report", 60*time.Millisecond)
+	assert.NoError(t, err)
+	mr.SetTTL(LockKeyPrefix+"report", time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 60*time.Millisecond, mr.TTL(LockKeyPrefix+"report"))
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func TestLockLost(t *testing.T) {
+	ctx, mr := newRedisContext(t, nil)
+
+	lock, err := Lock(ctx, "report", 30*time.Millisecond)
+	assert.NoError(t, err)
+	mr.Set(LockKeyPrefix+"report", "99")
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lock was not reported lost")
+	}
+	assert.ErrorIs(t, lock.Unlock(ctx), ErrLockLost)
+	value, _ := mr.Get(LockKeyPrefix + "report")
+	assert.Equal(t, "99", value)
+}
+
+func TestLead(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, _ := newRedisContext(t, parent)
+
+	var leaders, running int32
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- Lead(ctx, "scheduler", 30*time.Millisecond, func(leaderCtx Context) error {
+				assert.Equal(t, int32(1), atomic.AddInt32(&running, 1))
+				atomic.AddInt32(&leaders, 1)
+				<-leaderCtx.Done()
+				atomic.AddInt32(&running, -1)
+				return leaderCtx.Err()
+			})
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&leaders))
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+}
+
+func TestLeadStepsDownOnLostLock(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx, mr := newRedisContext(t, parent)
+
+	terms := make(chan struct{}, 2)
+	go Lead(ctx, "scheduler", 30*time.Millisecond, func(leaderCtx Context) error {
+		terms <- struct{}{}
+		<-leaderCtx.Done()
+		return nil
+	})
+
+	<-terms
+	mr.Set(LockKeyPrefix+"scheduler", "99")
+	time.Sleep(50 * time.Millisecond)
+	mr.Del(LockKeyPrefix + "scheduler")
+	select {
+	case <-terms:
+	case <-time.After(time.Second):
+		t.Fatal("the leader did not campaign again")
+	}
+}
+
+func TestLeadReturnsError(t *testing.T) {
+	ctx, mr := newRedisContext(t, nil)
+	failure := errors.New("job failed")
+
+	err := Lead(ctx, "scheduler", time.Minute, func(Context) error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.False(t, mr.Exists(LockKeyPrefix+"scheduler"))
+}
@@ -0,0 +1,15 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/argonlab-io/bucharest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockContext(t *testing.T) (bucharest.Context, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	return bucharest.NewContextWithOptions(&bucharest.ContextOptions{SQL: db}), mock
+}
@@ -0,0 +1,362 @@
+package migrations
+
+import (
+	"context"
+	"crypto"
+	_ "crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+const DefaultTable = "schema_migrations"
+const DefaultLockID = 7246318
+
+var ErrChecksumMismatch = errors.New("an applied migration has been modified")
+var ErrDuplicateVersion = errors.New("found two migrations with the same version")
+var ErrMissingDown = errors.New("migration has no down file")
+var ErrMissingUp = errors.New("migration has no up file")
+var ErrUnknownVersion = errors.New("the database has a migration version that is not in the migration files")
+
+var filenamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Migration
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool
+}
+
+type Options struct {
+	Table  string
+	LockID int64
+	DryRun bool
+}
+
+type Migrator struct {
+	migrations []Migration
+	options    *Options
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+func New(fsys fs.FS, options *Options) (*Migrator, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if options.Table == "" {
+		options.Table = DefaultTable
+	}
+	if options.LockID == 0 {
+		options.LockID = DefaultLockID
+	}
+
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{migrations: migrations, options: options}, nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func (m *Migrator) Up(ctx bucharest.Context) ([]Migration, error) {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo applies pending migrations up to and including version, or all of them
+// when version is 0.
+func (m *Migrator) UpTo(ctx bucharest.Context, version int64) (applied []Migration, err error) {
+	err = m.run(ctx, func(conn *sql.Conn, dialect string, state map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if version != 0 && migration.Version > version {
+				break
+			}
+			if _, ok := state[migration.Version]; ok {
+				continue
+			}
+			if !m.options.DryRun {
+				insert := sqlx.Rebind(sqlx.BindType(dialect), "INSERT INTO "+m.options.Table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)")
+				if err := m.exec(ctx, conn, dialect, migration.Up, insert, migration.Version, migration.Name, migration.Checksum, time.Now().UTC()); err != nil {
+					return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+				}
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (m *Migrator) Down(ctx bucharest.Context, steps int) (reverted []Migration, err error) {
+	err = m.run(ctx, func(conn *sql.Conn, dialect string, state map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := state[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrMissingDown, migration.Version, migration.Name)
+			}
+			if !m.options.DryRun {
+				remove := sqlx.Rebind(sqlx.BindType(dialect), "DELETE FROM "+m.options.Table+" WHERE version = ?")
+				if err := m.exec(ctx, conn, dialect, migration.Down, remove, migration.Version); err != nil {
+					return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+				}
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (m *Migrator) Status(ctx bucharest.Context) ([]Status, error) {
+	state, err := m.state(ctx, ctx.SQL())
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if applied, ok := state[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = applied.appliedAt
+			status.ChecksumMismatch = applied.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) run(ctx bucharest.Context, fn func(conn *sql.Conn, dialect string, state map[int64]appliedMigration) error) error {
+	dialect := bucharest.DriverName(ctx.SQL())
+	conn, err := ctx.SQL().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !m.options.DryRun {
+		unlock, err := lock(ctx, conn, dialect, m.options.LockID)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		create := "CREATE TABLE IF NOT EXISTS " + m.options.Table + " (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum VARCHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)"
+		if _, err := conn.ExecContext(ctx, create); err != nil {
+			return err
+		}
+	}
+
+	state, err := m.state(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(state); err != nil {
+		return err
+	}
+	return fn(conn, dialect, state)
+}
+
+func (m *Migrator) state(ctx context.Context, db bucharest.SQLHandle) (map[int64]appliedMigration, error) {
+	state := make(map[int64]appliedMigration)
+	rows, err := db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM "+m.options.Table)
+	if err != nil {
+		if m.options.DryRun {
+			return state, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var applied appliedMigration
+		if err := rows.Scan(&version, &applied.checksum, &applied.appliedAt); err != nil {
+			return nil, err
+		}
+		state[version] = applied
+	}
+	return state, rows.Err()
+}
+
+func (m *Migrator) verify(state map[int64]appliedMigration) error {
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, applied := range state {
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+		if migration.Checksum != applied.checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, dialect string, statement string, record string, args ...any) error {
+	statements := []string{statement}
+	if dialect == "mysql" {
+		statements = SplitStatements(statement)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if statement == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SplitStatements splits a migration file on the semicolons that are outside of
+// quotes and comments, and drops the parts that only hold comments. Migrations
+// are split on MySQL, which only runs one statement per query unless the DSN
+// sets multiStatements. DELIMITER is not supported.
+func SplitStatements(script string) []string {
+	var statements []string
+	start, code := 0, false
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			code = true
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"), c == '#':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			if code {
+				statements = append(statements, strings.TrimSpace(script[start:i]))
+			}
+			start, code = i+1, false
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			code = true
+		}
+	}
+	if code {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements
+}
+
+func lock(ctx context.Context, conn *sql.Conn, dialect string, id int64) (func(), error) {
+	var acquire, release string
+	switch dialect {
+	case "postgres", "pgx":
+		acquire, release = "SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+	case "mysql":
+		acquire, release = "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"
+	default:
+		return func() {}, nil
+	}
+
+	key := any(id)
+	if dialect == "mysql" {
+		key = strconv.FormatInt(id, 10)
+	}
+	if _, err := conn.ExecContext(ctx, acquire, key); err != nil {
+		return nil, err
+	}
+	return func() { conn.ExecContext(context.WithoutCancel(ctx), release, key) }, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := filenamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		}
+		if match[3] == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrMissingUp, migration.Version, migration.Name)
+		}
+		migration.Checksum = utils.NewEncoder(&migration.Up).Hex(crypto.SHA256)
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
@@ -0,0 +1,225 @@
+package migrations_test
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest/migrations"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var createUsers = "CREATE TABLE users (id BIGINT PRIMARY KEY);"
+var createPosts = "CREATE TABLE posts (id BIGINT PRIMARY KEY);"
+
+var testFS = fstest.MapFS{
+	"0001_create_users.up.sql":   {Data: []byte(createUsers)},
+	"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"0002_create_posts.up.sql":   {Data: []byte(createPosts)},
+	"0002_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+	"README.md":                  {Data: []byte("ignored")},
+}
+
+func checksum(s string) string {
+	return utils.NewEncoder(&s).Hex(crypto.SHA256)
+}
+
+type anyTime struct{}
+
+func (anyTime) Match(v driver.Value) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func expectState(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum VARCHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+func stateRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"version", "checksum", "applied_at"})
+}
+
+func TestNew(t *testing.T) {
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+	migrations := migrator.Migrations()
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "create_users", migrations[0].Name)
+	assert.Equal(t, createUsers, migrations[0].Up)
+	assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+	assert.Equal(t, checksum(createUsers), migrations[0].Checksum)
+	assert.Equal(t, int64(2), migrations[1].Version)
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(fstest.MapFS{"0001_foo.down.sql": {Data: []byte("DROP TABLE foo;")}}, nil)
+	assert.ErrorIs(t, err, ErrMissingUp)
+
+	_, err = New(fstest.MapFS{
+		"0001_foo.up.sql": {Data: []byte("CREATE TABLE foo;")},
+		"0001_bar.up.sql": {Data: []byte("CREATE TABLE bar;")},
+	}, nil)
+	assert.ErrorIs(t, err, ErrDuplicateVersion)
+}
+
+func TestUp(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+
+	expectState(mock, stateRows().AddRow(1, checksum(createUsers), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(createPosts).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)").
+		WithArgs(2, "create_posts", checksum(createPosts), anyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, int64(2), applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpTo(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+
+	expectState(mock, stateRows())
+	mock.ExpectBegin()
+	mock.ExpectExec(createUsers).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)").
+		WithArgs(1, "create_users", checksum(createUsers), anyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.UpTo(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+
+	migrationErr := errors.New("syntax error")
+	expectState(mock, stateRows())
+	mock.ExpectBegin()
+	mock.ExpectExec(createUsers).WillReturnError(migrationErr)
+	mock.ExpectRollback()
+
+	applied, err := migrator.Up(ctx)
+	assert.ErrorIs(t, err, migrationErr)
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpChecksumMismatch(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+
+	expectState(mock, stateRows().AddRow(1, "modified", time.Now()))
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	expectState(mock, stateRows().AddRow(3, "unknown", time.Now()))
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpDryRun(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, &Options{DryRun: true})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").WillReturnError(errors.New("no such table"))
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, &Options{Table: "migrations"})
+	assert.NoError(t, err)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum VARCHAR(64) NOT NULL, applied_at TIMESTAMP NOT NULL)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM migrations").
+		WillReturnRows(stateRows().AddRow(1, checksum(createUsers), time.Now()).AddRow(2, checksum(createPosts), time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE posts;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM migrations WHERE version = ?").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatus(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(testFS, nil)
+	assert.NoError(t, err)
+
+	appliedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(stateRows().AddRow(1, "modified", appliedAt))
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.True(t, statuses[0].ChecksumMismatch)
+	assert.Equal(t, appliedAt, statuses[0].AppliedAt)
+	assert.False(t, statuses[1].Applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDownMissingDown(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	migrator, err := New(fstest.MapFS{"0001_create_users.up.sql": {Data: []byte(createUsers)}}, nil)
+	assert.NoError(t, err)
+
+	expectState(mock, stateRows().AddRow(1, checksum(createUsers), time.Now()))
+	reverted, err := migrator.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrMissingDown)
+	assert.Empty(t, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "CREATE TABLE users (id BIGINT, name VARCHAR(255) DEFAULT 'a;b');\n" +
+		"-- a comment; with a semicolon\n" +
+		"INSERT INTO users VALUES (1, \"it\\\"s; fine\");\n" +
+		"/* block; comment */ INSERT INTO `odd;table` VALUES (2);\n" +
+		"# only a comment;\n" +
+		"  ;\n" +
+		"UPDATE users SET name = 'x''y;' WHERE id = 1\n"
+
+	assert.Equal(t, []string{
+		"CREATE TABLE users (id BIGINT, name VARCHAR(255) DEFAULT 'a;b')",
+		"-- a comment; with a semicolon\nINSERT INTO users VALUES (1, \"it\\\"s; fine\")",
+		"/* block; comment */ INSERT INTO `odd;table` VALUES (2)",
+		"UPDATE users SET name = 'x''y;' WHERE id = 1",
+	}, SplitStatements(script))
+	assert.Empty(t, SplitStatements(" ; -- nothing\n"))
+}
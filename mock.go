@@ -27,3 +27,7 @@ func NewMockContext(parentContext Context, mock sqlmock.Sqlmock) MockContext {
 func (ctx mockContext) SQLMock() sqlmock.Sqlmock {
 	return ctx.sqlMock
 }
+
+func (ctx mockContext) base() *BuchatrestContext {
+	return baseOf(ctx.Context)
+}
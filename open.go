@@ -0,0 +1,352 @@
+package bucharest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const DefaultPingTimeout = 5 * time.Second
+
+var ErrNoDSN = errors.New("DB_DSN is required when DB_DRIVER is not postgres, mysql or sqlite")
+var ErrUnsupportedDriver = errors.New("there is no GORM dialector for this database driver")
+
+type DBConfig struct {
+	Driver          string        `mapstructure:"driver"`
+	DSN             string        `mapstructure:"dsn"`
+	Host            string        `mapstructure:"host"`
+	Port            int           `mapstructure:"port"`
+	User            string        `mapstructure:"user"`
+	Password        string        `mapstructure:"password"`
+	Name            string        `mapstructure:"name"`
+	SSLMode         string        `mapstructure:"sslmode"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+}
+
+// RedisConfig opens a single node client from Addr, a sentinel failover client
+// when MasterName is set and a cluster client when Addrs has several nodes.
+type RedisConfig struct {
+	Addr         string   `mapstructure:"addr"`
+	Addrs        []string `mapstructure:"addrs"`
+	MasterName   string   `mapstructure:"master_name"`
+	Password     string   `mapstructure:"password"`
+	DB           int      `mapstructure:"db"`
+	PoolSize     int      `mapstructure:"pool_size"`
+	MinIdleConns int      `mapstructure:"min_idle_conns"`
+}
+
+type OpenOptions struct {
+	Parent      context.Context
+	Logrus      *logrus.Logger
+	PingTimeout time.Duration
+	GORMConfig  *gorm.Config
+	Dialector   func(driverName string, db *sql.DB) (gorm.Dialector, error)
+}
+
+func (c *DBConfig) DriverName() string {
+	switch c.Driver {
+	case "postgres", "postgresql":
+		for _, registered := range sql.Drivers() {
+			if registered == c.Driver {
+				return c.Driver
+			}
+		}
+		return "pgx"
+	case "sqlite":
+		return "sqlite3"
+	}
+	return c.Driver
+}
+
+func (c *DBConfig) DataSourceName() (string, error) {
+	if c.DSN != "" {
+		return c.DSN, nil
+	}
+
+	switch c.DriverName() {
+	case "postgres", "pgx":
+		dsn := &url.URL{Scheme: "postgres", Host: c.Host, Path: "/" + c.Name}
+		if c.Port != 0 {
+			dsn.Host = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+		}
+		if c.User != "" {
+			dsn.User = url.UserPassword(c.User, c.Password)
+		}
+		if c.SSLMode != "" {
+			dsn.RawQuery = url.Values{"sslmode": {c.SSLMode}}.Encode()
+		}
+		return dsn.String(), nil
+	case "mysql":
+		config := mysql.NewConfig()
+		config.User = c.User
+		config.Passwd = c.Password
+		config.Net = "tcp"
+		config.Addr = c.Host
+		if c.Port != 0 {
+			config.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+		}
+		config.DBName = c.Name
+		config.ParseTime = true
+		return config.FormatDSN(), nil
+	case "sqlite3":
+		return c.Name, nil
+	}
+	return "", ErrNoDSN
+}
+
+func (options *OpenOptions) withDefaults() *OpenOptions {
+	o := &OpenOptions{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Parent == nil {
+		o.Parent = context.Background()
+	}
+	if o.PingTimeout == 0 {
+		o.PingTimeout = DefaultPingTimeout
+	}
+	if o.GORMConfig == nil {
+		o.GORMConfig = &gorm.Config{}
+	}
+	if o.Dialector == nil {
+		o.Dialector = newGORMDialector
+	}
+	return o
+}
+
+func OpenFromENV(env ENV, options *OpenOptions) (*ContextOptions, error) {
+	options = options.withDefaults()
+	contextOptions := &ContextOptions{
+		ENV:    env,
+		Logrus: options.Logrus,
+		Parent: options.Parent,
+	}
+
+	dbConfig, err := loadDBConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	if dbConfig.Driver != "" {
+		db, err := openSQL(dbConfig, options)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := NewContextOptionsFromSQL(db, dbConfig.DriverName(), options)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		contextOptions.SQL = shared.SQL
+		contextOptions.SQLX = shared.SQLX
+		contextOptions.GORM = shared.GORM
+	}
+
+	redisConfig, err := loadRedisConfig(env)
+	if err != nil {
+		closeContextOptions(contextOptions)
+		return nil, err
+	}
+	if redisConfig.Addr != "" || len(redisConfig.Addrs) != 0 {
+		contextOptions.Redis, err = openRedis(redisConfig, options)
+		if err != nil {
+			closeContextOptions(contextOptions)
+			return nil, err
+		}
+	}
+
+	return contextOptions, nil
+}
+
+func NewContextOptionsFromSQL(db *sql.DB, driverName string, options *OpenOptions) (*ContextOptions, error) {
+	options = options.withDefaults()
+	if driverName == "" {
+		driverName = DriverName(db)
+	}
+
+	gormDB, err := openGORM(db, driverName, options)
+	if err != nil {
+		return nil, err
+	}
+	return &ContextOptions{
+		GORM:   gormDB,
+		Logrus: options.Logrus,
+		Parent: options.Parent,
+		SQL:    db,
+		SQLX:   sqlx.NewDb(db, driverName),
+	}, nil
+}
+
+func OpenSQLFromENV(env ENV, options *OpenOptions) (*sql.DB, error) {
+	config, err := loadDBConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	return openSQL(config, options.withDefaults())
+}
+
+func OpenSQLXFromENV(env ENV, options *OpenOptions) (*sqlx.DB, error) {
+	config, err := loadDBConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openSQL(config, options.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(db, config.DriverName()), nil
+}
+
+func OpenGORMFromENV(env ENV, options *OpenOptions) (*gorm.DB, error) {
+	options = options.withDefaults()
+	config, err := loadDBConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openSQL(config, options)
+	if err != nil {
+		return nil, err
+	}
+	gormDB, err := openGORM(db, config.DriverName(), options)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return gormDB, nil
+}
+
+func OpenRedisFromENV(env ENV, options *OpenOptions) (redis.UniversalClient, error) {
+	config, err := loadRedisConfig(env)
+	if err != nil {
+		return nil, err
+	}
+	return openRedis(config, options.withDefaults())
+}
+
+func loadDBConfig(env ENV) (*DBConfig, error) {
+	config := &DBConfig{}
+	return config, env.Sub("DB").Unmarshal(config)
+}
+
+func loadRedisConfig(env ENV) (*RedisConfig, error) {
+	config := &RedisConfig{}
+	return config, env.Sub("REDIS").Unmarshal(config)
+}
+
+func openSQL(config *DBConfig, options *OpenOptions) (*sql.DB, error) {
+	dsn, err := config.DataSourceName()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(config.DriverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if config.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
+
+	ctx, cancel := context.WithTimeout(options.Parent, options.PingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping %s: %w", config.DriverName(), err)
+	}
+	return db, nil
+}
+
+func openGORM(db *sql.DB, driverName string, options *OpenOptions) (*gorm.DB, error) {
+	dialector, err := options.Dialector(driverName, db)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector, options.GORMConfig)
+}
+
+func openRedis(config *RedisConfig, options *OpenOptions) (redis.UniversalClient, error) {
+	addrs := config.Addrs
+	if config.Addr != "" {
+		addrs = append([]string{config.Addr}, addrs...)
+	}
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:        addrs,
+		MasterName:   config.MasterName,
+		Password:     config.Password,
+		DB:           config.DB,
+		PoolSize:     config.PoolSize,
+		MinIdleConns: config.MinIdleConns,
+	})
+
+	ctx, cancel := context.WithTimeout(options.Parent, options.PingTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ping redis: %w", err)
+	}
+	return client, nil
+}
+
+func DriverName(db *sql.DB) string {
+	switch driver := db.Driver().(type) {
+	case *loggedDriver:
+		return DriverName(driver.db)
+	case *stdlib.Driver:
+		return "pgx"
+	case *mysql.MySQLDriver:
+		return "mysql"
+	}
+
+	switch reflect.TypeOf(db.Driver()).String() {
+	case "*pq.Driver":
+		return "postgres"
+	case "*sqlite3.SQLiteDriver":
+		return "sqlite3"
+	}
+	return ""
+}
+
+func newGORMDialector(driverName string, db *sql.DB) (gorm.Dialector, error) {
+	switch driverName {
+	case "postgres", "pgx":
+		return postgres.New(postgres.Config{Conn: db}), nil
+	case "mysql":
+		return gormmysql.New(gormmysql.Config{Conn: db}), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedDriver, driverName)
+}
+
+func closeContextOptions(options *ContextOptions) {
+	if options.SQL != nil {
+		options.SQL.Close()
+	}
+	if options.Redis != nil {
+		options.Redis.Close()
+	}
+}
@@ -0,0 +1,17 @@
+package outbox_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/argonlab-io/bucharest"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockContext(t *testing.T, parent context.Context) (bucharest.Context, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	return bucharest.NewContextWithOptions(&bucharest.ContextOptions{Parent: parent, SQL: db, SQLX: sqlx.NewDb(db, "pgx")}), mock
+}
@@ -0,0 +1,244 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/jmoiron/sqlx"
+)
+
+const DefaultTable = "outbox_events"
+const DefaultBatchSize = 100
+const DefaultPollInterval = time.Second
+const DefaultMaxAttempts = 10
+const MaxRelayBackoff = time.Minute
+
+var ErrNoTransaction = errors.New("outbox events must be added inside bucharest.WithTx")
+
+type Event struct {
+	ID        int64           `db:"id" json:"id"`
+	Topic     string          `db:"topic" json:"topic"`
+	Key       string          `db:"event_key" json:"key"`
+	Payload   json.RawMessage `db:"payload" json:"payload"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	Attempts  int             `db:"attempts" json:"attempts"`
+}
+
+type Options struct {
+	Table        string
+	BatchSize    int
+	PollInterval time.Duration
+	// MaxAttempts is how many times an event is tried before the relay gives
+	// up on it. The event stays in the table with its last error.
+	MaxAttempts int
+	Backoff     func(attempts int) time.Duration
+	// OnError is called with the errors of Relay. When it is nil they are
+	// logged at error level with the logger of the relay's context.
+	OnError func(err error)
+}
+
+type Outbox struct {
+	options *Options
+}
+
+func New(options *Options) *Outbox {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Table == "" {
+		o.Table = DefaultTable
+	}
+	if o.BatchSize == 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.Backoff == nil {
+		o.Backoff = ExponentialBackoff
+	}
+	return &Outbox{options: o}
+}
+
+// ExponentialBackoff waits 2^attempts seconds, up to an hour.
+func ExponentialBackoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return time.Hour
+	}
+	return time.Second << attempts
+}
+
+// Schema returns the CREATE TABLE statement of the outbox table for a driver
+// name, for use in a migration.
+func (o *Outbox) Schema(driverName string) string {
+	id := "BIGINT PRIMARY KEY AUTO_INCREMENT"
+	payload := "TEXT"
+	switch driverName {
+	case "postgres", "pgx":
+		id, payload = "BIGSERIAL PRIMARY KEY", "JSONB"
+	case "sqlite3":
+		id = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+	return "CREATE TABLE IF NOT EXISTS " + o.options.Table + " (" +
+		"id " + id + ", " +
+		"topic VARCHAR(255) NOT NULL, " +
+		"event_key VARCHAR(255) NOT NULL, " +
+		"payload " + payload + " NOT NULL, " +
+		"created_at TIMESTAMP NOT NULL, " +
+		"attempts INT NOT NULL DEFAULT 0, " +
+		"next_attempt_at TIMESTAMP NOT NULL, " +
+		"published_at TIMESTAMP NULL, " +
+		"last_error TEXT NULL)"
+}
+
+// Add writes an event in the transaction of ctx, so that it is published only
+// if the transaction commits. Payloads that are not []byte or json.RawMessage
+// are encoded as JSON.
+func (o *Outbox) Add(ctx bucharest.Context, topic, key string, payload any) error {
+	if !bucharest.InTx(ctx) {
+		return ErrNoTransaction
+	}
+
+	var b []byte
+	switch p := payload.(type) {
+	case []byte:
+		b = p
+	case json.RawMessage:
+		b = p
+	default:
+		var err error
+		if b, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	_, err := ctx.SQLHandle().ExecContext(ctx, rebind(ctx, "INSERT INTO "+o.options.Table+" (topic, event_key, payload, created_at, attempts, next_attempt_at) VALUES (?, ?, ?, ?, 0, ?)"), topic, key, string(b), now, now)
+	return err
+}
+
+// Relay publishes pending events to sink until ctx is done. After a failed
+// batch it waits twice as long as the last time, from PollInterval up to
+// MaxRelayBackoff.
+func (o *Outbox) Relay(ctx bucharest.Context, sink Sink) error {
+	wait := o.options.PollInterval
+	for {
+		n, err := o.RelayOnce(ctx, sink)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				o.onError(ctx, err)
+			}
+			wait = min(wait*2, max(MaxRelayBackoff, o.options.PollInterval))
+		case n == o.options.BatchSize:
+			wait = o.options.PollInterval
+			continue
+		default:
+			wait = o.options.PollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due events and returns how many it tried.
+// Rows are locked with SKIP LOCKED where the database supports it so that
+// several relays can run side by side.
+func (o *Outbox) RelayOnce(ctx bucharest.Context, sink Sink) (int, error) {
+	var events []Event
+	err := bucharest.WithTx(ctx, func(txCtx bucharest.Context) error {
+		var err error
+		if events, err = o.due(txCtx); err != nil {
+			return err
+		}
+		for i := range events {
+			if err := o.publish(txCtx, sink, &events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(events), err
+}
+
+func (o *Outbox) due(ctx bucharest.Context) ([]Event, error) {
+	query := "SELECT id, topic, event_key, payload, created_at, attempts FROM " + o.options.Table +
+		" WHERE published_at IS NULL AND attempts < ? AND next_attempt_at <= ? ORDER BY id LIMIT ?"
+	switch bucharest.SQLDriverName(ctx) {
+	case "postgres", "pgx", "mysql":
+		query += " FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := ctx.SQLHandle().QueryContext(ctx, rebind(ctx, query), o.options.MaxAttempts, time.Now().UTC(), o.options.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Key, &payload, &event.CreatedAt, &event.Attempts); err != nil {
+			return nil, err
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (o *Outbox) publish(ctx bucharest.Context, sink Sink, event *Event) error {
+	db := ctx.SQLHandle()
+	publishErr := sink.Publish(ctx, event)
+	event.Attempts++
+	now := time.Now().UTC()
+
+	if publishErr == nil {
+		_, err := db.ExecContext(ctx, rebind(ctx, "UPDATE "+o.options.Table+" SET published_at = ?, attempts = ?, last_error = NULL WHERE id = ?"), now, event.Attempts, event.ID)
+		return err
+	}
+
+	next := now.Add(o.options.Backoff(event.Attempts))
+	if _, err := db.ExecContext(ctx, rebind(ctx, "UPDATE "+o.options.Table+" SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?"), event.Attempts, next, publishErr.Error(), event.ID); err != nil {
+		return err
+	}
+	o.onError(ctx, fmt.Errorf("publish event %d to %s: %w", event.ID, event.Topic, publishErr))
+	return nil
+}
+
+// rebind turns the ? placeholders of query into those of the driver of ctx.
+// The statements run on SQLHandle, which every transaction has whether ctx
+// was built with SQL, SQLX or only GORM.
+func rebind(ctx bucharest.Context, query string) string {
+	return sqlx.Rebind(sqlx.BindType(bucharest.SQLDriverName(ctx)), query)
+}
+
+func (o *Outbox) onError(ctx bucharest.Context, err error) {
+	if o.options.OnError != nil {
+		o.options.OnError(err)
+		return
+	}
+	bucharest.Logger(ctx).WithError(err).Error("outbox relay failed")
+}
+
+type Sink interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+type SinkFunc func(ctx context.Context, event *Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
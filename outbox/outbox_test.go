@@ -0,0 +1,170 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/outbox"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const selectEvents = "SELECT id, topic, event_key, payload, created_at, attempts FROM outbox_events WHERE published_at IS NULL AND attempts < $1 AND next_attempt_at <= $2 ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED"
+
+func eventRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "topic", "event_key", "payload", "created_at", "attempts"})
+}
+
+func TestAdd(t *testing.T) {
+	ctx, mock := newMockContext(t, nil)
+	events := New(nil)
+
+	assert.ErrorIs(t, events.Add(ctx, "user.created", "1", nil), ErrNoTransaction)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO outbox_events (topic, event_key, payload, created_at, attempts, next_attempt_at) VALUES ($1, $2, $3, $4, 0, $5)").
+		WithArgs("user.created", "1", `{"name":"alice"}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, bucharest.WithTx(ctx, func(txCtx bucharest.Context) error {
+		return events.Add(txCtx, "user.created", "1", map[string]string{"name": "alice"})
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayOnce(t *testing.T) {
+	ctx, mock := newMockContext(t, nil)
+	events := New(&Options{BatchSize: 10})
+	sink := NewMemorySink()
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectEvents).
+		WithArgs(DefaultMaxAttempts, sqlmock.AnyArg(), 10).
+		WillReturnRows(eventRows().AddRow(1, "user.created", "1", `{"name":"alice"}`, createdAt, 0))
+	mock.ExpectExec("UPDATE outbox_events SET published_at = $1, attempts = $2, last_error = NULL WHERE id = $3").
+		WithArgs(sqlmock.AnyArg(), 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := events.RelayOnce(ctx, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	published := sink.Events()
+	assert.Len(t, published, 1)
+	assert.Equal(t, int64(1), published[0].ID)
+	assert.Equal(t, "user.created", published[0].Topic)
+	assert.JSONEq(t, `{"name":"alice"}`, string(published[0].Payload))
+	assert.Equal(t, createdAt, published[0].CreatedAt)
+}
+
+func TestOutboxWithOnlyGORM(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	assert.NoError(t, err)
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{GORM: gormDB})
+	events := New(nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO outbox_events (topic, event_key, payload, created_at, attempts, next_attempt_at) VALUES ($1, $2, $3, $4, 0, $5)").
+		WithArgs("user.created", "1", `{}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, bucharest.WithTx(ctx, func(txCtx bucharest.Context) error {
+		return events.Add(txCtx, "user.created", "1", json.RawMessage(`{}`))
+	}))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectEvents).
+		WithArgs(DefaultMaxAttempts, sqlmock.AnyArg(), DefaultBatchSize).
+		WillReturnRows(eventRows().AddRow(1, "user.created", "1", `{}`, time.Now(), 0))
+	mock.ExpectExec("UPDATE outbox_events SET published_at = $1, attempts = $2, last_error = NULL WHERE id = $3").
+		WithArgs(sqlmock.AnyArg(), 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	n, err := events.RelayOnce(ctx, NewMemorySink())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayOnceRetriesWithBackoff(t *testing.T) {
+	ctx, mock := newMockContext(t, nil)
+	var reported error
+	events := New(&Options{
+		Backoff: func(attempts int) time.Duration { return time.Duration(attempts) * time.Minute },
+		OnError: func(err error) { reported = err },
+	})
+
+	sinkErr := errors.New("unavailable")
+	sink := SinkFunc(func(context.Context, *Event) error { return sinkErr })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectEvents).
+		WithArgs(DefaultMaxAttempts, sqlmock.AnyArg(), DefaultBatchSize).
+		WillReturnRows(eventRows().AddRow(1, "user.created", "1", `{}`, time.Now(), 2))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = $1, next_attempt_at = $2, last_error = $3 WHERE id = $4").
+		WithArgs(3, sqlmock.AnyArg(), "unavailable", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := events.RelayOnce(ctx, sink)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.ErrorIs(t, reported, sinkErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayStopsWithContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx, mock := newMockContext(t, parent)
+	events := New(&Options{OnError: func(err error) { t.Errorf("unexpected error: %v", err) }})
+
+	assert.NoError(t, events.Relay(ctx, NewMemorySink()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBacksOffAfterErrors(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	logger, hook := test.NewNullLogger()
+	parent, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Parent: parent, SQL: db, SQLX: sqlx.NewDb(db, "pgx"), Logrus: logger})
+	ctx.SetValue(bucharest.RequestIDKey, "request-1")
+
+	// Every begin fails, so the relay tries at 0, 40 and 120ms rather than
+	// every 20ms.
+	assert.NoError(t, New(&Options{PollInterval: 20 * time.Millisecond}).Relay(ctx, NewMemorySink()))
+	entries := hook.AllEntries()
+	assert.GreaterOrEqual(t, len(entries), 2)
+	assert.LessOrEqual(t, len(entries), 4)
+	assert.Equal(t, "outbox relay failed", entries[0].Message)
+	assert.Equal(t, "request-1", entries[0].Data["request_id"])
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, ExponentialBackoff(1))
+	assert.Equal(t, 8*time.Second, ExponentialBackoff(3))
+	assert.Equal(t, time.Hour, ExponentialBackoff(12))
+	assert.Equal(t, time.Hour, ExponentialBackoff(100))
+}
+
+func TestSchema(t *testing.T) {
+	events := New(&Options{Table: "events"})
+	assert.Contains(t, events.Schema("pgx"), "CREATE TABLE IF NOT EXISTS events (id BIGSERIAL PRIMARY KEY")
+	assert.Contains(t, events.Schema("mysql"), "id BIGINT PRIMARY KEY AUTO_INCREMENT")
+	assert.Contains(t, events.Schema("sqlite3"), "id INTEGER PRIMARY KEY AUTOINCREMENT")
+}
@@ -0,0 +1,94 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Publish(_ context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// RedisStreamSink appends each event to the stream Prefix+topic.
+type RedisStreamSink struct {
+	Client redis.UniversalClient
+	Prefix string
+	MaxLen int64
+}
+
+func (s *RedisStreamSink) Publish(ctx context.Context, event *Event) error {
+	return s.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.Prefix + event.Topic,
+		MaxLen: s.MaxLen,
+		Approx: s.MaxLen > 0,
+		Values: map[string]any{
+			"id":         strconv.FormatInt(event.ID, 10),
+			"key":        event.Key,
+			"payload":    string(event.Payload),
+			"created_at": event.CreatedAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
+
+// WebhookSink POSTs each event as JSON to URL and treats any non-2xx response
+// as a failure.
+type WebhookSink struct {
+	URL     string
+	Client  *http.Client
+	Headers http.Header
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.Headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/outbox"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+var testEvent = &Event{
+	ID:        1,
+	Topic:     "user.created",
+	Key:       "1",
+	Payload:   json.RawMessage(`{"name":"alice"}`),
+	CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := NewMemorySink()
+	assert.NoError(t, sink.Publish(context.Background(), testEvent))
+	assert.Equal(t, []Event{*testEvent}, sink.Events())
+}
+
+func TestRedisStreamSink(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sink := &RedisStreamSink{Client: client, Prefix: "events:"}
+
+	assert.NoError(t, sink.Publish(context.Background(), testEvent))
+	messages, err := client.XRange(context.Background(), "events:user.created", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "1", messages[0].Values["id"])
+	assert.Equal(t, `{"name":"alice"}`, messages[0].Values["payload"])
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.Key == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, Headers: http.Header{"X-Token": {"secret"}}}
+	assert.NoError(t, sink.Publish(context.Background(), testEvent))
+	assert.Equal(t, testEvent.Topic, received.Topic)
+	assert.JSONEq(t, string(testEvent.Payload), string(received.Payload))
+
+	failing := *testEvent
+	failing.Key = "fail"
+	assert.ErrorContains(t, sink.Publish(context.Background(), &failing), "500")
+}
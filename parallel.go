@@ -0,0 +1,96 @@
+package bucharest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Parallel runs fns concurrently and waits for them. Each gets a Context with
+// the dependencies of ctx that is cancelled as soon as one of them fails, and
+// the errors they return, panics included, are joined in the order of fns.
+// When ctx is done before all of them started, its error is joined too.
+// Queries of a transaction of ctx cannot run in parallel, so call it outside
+// WithTx.
+func Parallel(ctx Context, fns ...func(ctx Context) error) error {
+	return fanOut(ctx, len(fns), len(fns), func(ctx Context, i int) error {
+		return fns[i](ctx)
+	})
+}
+
+// ForEach is Parallel for calling fn with every item, with at most limit calls
+// running at once. The items that have not started when a call fails are
+// skipped. limit <= 0 means no limit.
+func ForEach[T any](ctx Context, limit int, items []T, fn func(ctx Context, item T) error) error {
+	return fanOut(ctx, limit, len(items), func(ctx Context, i int) error {
+		return fn(ctx, items[i])
+	})
+}
+
+func fanOut(ctx Context, limit, n int, fn func(ctx Context, i int) error) error {
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	parent, cancel := context.WithCancel(ctx)
+	defer cancel()
+	child := WithParent(ctx, parent)
+
+	errs := make([]error, n)
+	failed := -1
+	var once sync.Once
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if errs[i] = callParallel(child, i, fn); errs[i] != nil {
+					once.Do(func() {
+						failed = i
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	fed := 0
+feed:
+	for ; fed < n; fed++ {
+		if parent.Err() != nil {
+			break
+		}
+		select {
+		case indexes <- fed:
+		case <-parent.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if fed < n && ctx.Err() != nil {
+		return errors.Join(append(errs, ctx.Err())...)
+	}
+	if ctx.Err() == nil {
+		// The siblings of the call that failed first only report that they
+		// were cancelled.
+		for i, err := range errs {
+			if i != failed && errors.Is(err, context.Canceled) {
+				errs[i] = nil
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func callParallel(ctx Context, i int, fn func(ctx Context, i int) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parallel call panicked: %v", r)
+		}
+	}()
+	return fn(ctx, i)
+}
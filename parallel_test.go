@@ -0,0 +1,120 @@
+package bucharest_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/argonlab-io/bucharest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	logger := logrus.New()
+	ctx := NewContextWithOptions(&ContextOptions{Logrus: logger})
+	ctx.SetValue("user", "alice")
+
+	var running, peak int32
+	results := make([]string, 3)
+	fn := func(i int) func(Context) error {
+		return func(ctx Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			assert.Same(t, logger, ctx.Log())
+			results[i] = ctx.Value("user").(string)
+			return nil
+		}
+	}
+
+	assert.NoError(t, Parallel(ctx, fn(0), fn(1), fn(2)))
+	assert.Equal(t, int32(3), peak)
+	assert.Equal(t, []string{"alice", "alice", "alice"}, results)
+	assert.NoError(t, Parallel(ctx))
+}
+
+func TestParallelCancelsSiblings(t *testing.T) {
+	ctx := NewContextWithOptions(nil)
+	failure := errors.New("failed")
+	var cancelled int32
+
+	err := Parallel(ctx,
+		func(ctx Context) error {
+			<-ctx.Done()
+			atomic.AddInt32(&cancelled, 1)
+			return ctx.Err()
+		},
+		func(ctx Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return failure
+		},
+		func(ctx Context) error {
+			time.Sleep(10 * time.Millisecond)
+			panic("boom")
+		},
+	)
+	assert.ErrorIs(t, err, failure)
+	assert.ErrorContains(t, err, "parallel call panicked: boom")
+	assert.NotErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(1), cancelled)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestParallelParentCancelled(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx := NewContextWithOptions(&ContextOptions{Parent: parent})
+	cancel()
+
+	err := Parallel(ctx, func(ctx Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestForEach(t *testing.T) {
+	ctx := NewContextWithOptions(nil)
+	var running, peak, sum int32
+	items := []int32{1, 2, 3, 4, 5, 6, 7, 8}
+
+	err := ForEach(ctx, 3, items, func(ctx Context, item int32) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&sum, item)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), peak)
+	assert.Equal(t, int32(36), sum)
+}
+
+func TestForEachStopsOnError(t *testing.T) {
+	ctx := NewContextWithOptions(nil)
+	var started int32
+
+	err := ForEach(ctx, 1, []int{1, 2, 3, 4}, func(ctx Context, item int) error {
+		atomic.AddInt32(&started, 1)
+		if item == 2 {
+			return errors.New("item 2 failed")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "item 2 failed")
+	assert.Equal(t, int32(2), started)
+}
@@ -0,0 +1,468 @@
+package bucharest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// QueryLogOptions logs the queries of the SQL, SQLX and GORM handles of a
+// Context, and of its replicas and transactions. The handles then return
+// logging pools on top of the ones in ContextOptions, which are still the ones
+// to configure and close.
+type QueryLogOptions struct {
+	SlowThreshold time.Duration
+	// SlowOnly skips queries that are neither slow nor failed.
+	SlowOnly bool
+}
+
+type querySource string
+
+const (
+	querySourceGORM querySource = "gorm"
+	querySourceSQL  querySource = "sql"
+	querySourceSQLX querySource = "sqlx"
+)
+
+type queryLogger struct {
+	logrus        *logrus.Logger
+	slowThreshold time.Duration
+	slowOnly      bool
+
+	mu    sync.Mutex
+	pools map[*sql.DB]*sql.DB
+	sqlxs map[*sqlx.DB]*sqlx.DB
+	gorms map[*gorm.DB]*gorm.DB
+}
+
+func newQueryLogger(options *QueryLogOptions, logger *logrus.Logger) *queryLogger {
+	if options == nil {
+		return nil
+	}
+	l := &queryLogger{
+		logrus:        logger,
+		slowThreshold: options.SlowThreshold,
+		slowOnly:      options.SlowOnly,
+		pools:         make(map[*sql.DB]*sql.DB),
+		sqlxs:         make(map[*sqlx.DB]*sqlx.DB),
+		gorms:         make(map[*gorm.DB]*gorm.DB),
+	}
+	if l.slowThreshold == 0 {
+		l.slowThreshold = DefaultSlowQueryThreshold
+	}
+	return l
+}
+
+func (l *queryLogger) log(ctx context.Context, query string, args []driver.NamedValue, begin time.Time, rows int64, err error) {
+	duration := time.Since(begin)
+	slow := duration >= l.slowThreshold
+	failed := err != nil && !errors.Is(err, sql.ErrNoRows)
+	if l.slowOnly && !slow && !failed {
+		return
+	}
+
+	caller, source := queryCaller()
+	fields := logrus.Fields{
+		"source":   string(source),
+		"sql":      query,
+		"duration": duration,
+		"rows":     rows,
+		"caller":   caller,
+	}
+	if len(args) > 0 {
+		redacted := make([]string, len(args))
+		for i := range redacted {
+			redacted[i] = RedactedValue
+		}
+		fields["args"] = redacted
+	}
+	if id := RequestID(ctx); id != "" {
+		fields["request_id"] = id
+	}
+
+	entry := l.logger(ctx).WithContext(ctx).WithFields(fields)
+	switch {
+	case failed:
+		entry.WithError(err).Error("query failed")
+	case slow:
+		entry.WithField("slow", true).Warn("slow query")
+	default:
+		entry.Debug("query")
+	}
+}
+
+func (l *queryLogger) logger(ctx context.Context) *logrus.Logger {
+	if c, ok := ctx.(contextBase); ok && c.base().logrus_ != nil {
+		return c.base().logrus_
+	}
+	if l.logrus != nil {
+		return l.logrus
+	}
+	return logrus.StandardLogger()
+}
+
+// sql returns the logging pool of db, which borrows its connections from db.
+func (l *queryLogger) sql(db *sql.DB) *sql.DB {
+	if l == nil || db == nil {
+		return db
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sqlLocked(db)
+}
+
+func (l *queryLogger) sqlLocked(db *sql.DB) *sql.DB {
+	if logged, ok := l.pools[db]; ok {
+		return logged
+	}
+	logged := sql.OpenDB(&loggedConnector{db: db, log: l})
+	// db does the pooling, the logging pool hands its connections back as
+	// soon as it is done with them.
+	logged.SetMaxIdleConns(0)
+	l.pools[db] = logged
+	return logged
+}
+
+func (l *queryLogger) sqlx(db *sqlx.DB) *sqlx.DB {
+	if l == nil || db == nil {
+		return db
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if logged, ok := l.sqlxs[db]; ok {
+		return logged
+	}
+	logged := sqlx.NewDb(l.sqlLocked(db.DB), db.DriverName())
+	logged.Mapper = db.Mapper
+	l.sqlxs[db] = logged
+	return logged
+}
+
+func (l *queryLogger) gorm(db *gorm.DB) *gorm.DB {
+	if l == nil || db == nil {
+		return db
+	}
+	pool, ok := db.Statement.ConnPool.(*sql.DB)
+	if !ok {
+		return db
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if logged, ok := l.gorms[db]; ok {
+		return logged
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logged := db.Session(&gorm.Session{Context: ctx})
+	logged.Statement.ConnPool = l.sqlLocked(pool)
+	l.gorms[db] = logged
+	return logged
+}
+
+// queryCaller returns the first frame outside of bucharest, GORM, sqlx and
+// database/sql, and which of them ran the query.
+func queryCaller() (string, querySource) {
+	source := querySourceSQL
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		switch {
+		case strings.HasPrefix(frame.Function, "gorm.io/"):
+			source = querySourceGORM
+		case strings.HasPrefix(frame.Function, "github.com/jmoiron/sqlx"):
+			source = querySourceSQLX
+		case !isQueryLibraryFrame(frame.Function):
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line), source
+		}
+		if !more {
+			return "", source
+		}
+	}
+}
+
+func isQueryLibraryFrame(function string) bool {
+	for _, prefix := range []string{"github.com/argonlab-io/bucharest.", "github.com/argonlab-io/bucharest/", "database/sql.", "runtime."} {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggedConnector connects the logging pool of db. Its connections run their
+// queries on a connection of db, or on the transaction begun on it.
+type loggedConnector struct {
+	db  *sql.DB
+	log *queryLogger
+}
+
+func (c *loggedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedConn{conn: conn, log: c.log}, nil
+}
+
+func (c *loggedConnector) Driver() driver.Driver {
+	return &loggedDriver{db: c.db}
+}
+
+type loggedDriver struct {
+	db *sql.DB
+}
+
+func (d *loggedDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("the query log driver only opens connections through its connector")
+}
+
+type loggedConn struct {
+	conn *sql.Conn
+	tx   *sql.Tx
+	log  *queryLogger
+}
+
+type sqlTarget interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (c *loggedConn) target() sqlTarget {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.conn
+}
+
+func (c *loggedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *loggedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.target().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedStmt{stmt: stmt, query: query, log: c.log}, nil
+}
+
+func (c *loggedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *loggedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *loggedConn) BeginTx(ctx context.Context, options driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.IsolationLevel(options.Isolation), ReadOnly: options.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	c.tx = tx
+	return &loggedTx{conn: c}, nil
+}
+
+func (c *loggedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	begin := time.Now()
+	result, err := c.target().ExecContext(ctx, query, namedArgs(args)...)
+	c.log.log(ctx, query, args, begin, rowsAffected(result), err)
+	return result, err
+}
+
+func (c *loggedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	begin := time.Now()
+	rows, err := c.target().QueryContext(ctx, query, namedArgs(args)...)
+	c.log.log(ctx, query, args, begin, -1, err)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedRows{rows: rows}, nil
+}
+
+func (c *loggedConn) Ping(ctx context.Context) error {
+	return c.conn.PingContext(ctx)
+}
+
+// CheckNamedValue passes the arguments through as they are, db converts them.
+func (c *loggedConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+type loggedTx struct {
+	conn *loggedConn
+}
+
+func (t *loggedTx) Commit() error {
+	defer func() { t.conn.tx = nil }()
+	return t.conn.tx.Commit()
+}
+
+func (t *loggedTx) Rollback() error {
+	defer func() { t.conn.tx = nil }()
+	return t.conn.tx.Rollback()
+}
+
+type loggedStmt struct {
+	stmt  *sql.Stmt
+	query string
+	log   *queryLogger
+}
+
+func (s *loggedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *loggedStmt) NumInput() int {
+	return -1
+}
+
+func (s *loggedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueArgs(args))
+}
+
+func (s *loggedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueArgs(args))
+}
+
+func (s *loggedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	begin := time.Now()
+	result, err := s.stmt.ExecContext(ctx, namedArgs(args)...)
+	s.log.log(ctx, s.query, args, begin, rowsAffected(result), err)
+	return result, err
+}
+
+func (s *loggedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	begin := time.Now()
+	rows, err := s.stmt.QueryContext(ctx, namedArgs(args)...)
+	s.log.log(ctx, s.query, args, begin, -1, err)
+	if err != nil {
+		return nil, err
+	}
+	return &loggedRows{rows: rows}, nil
+}
+
+func (s *loggedStmt) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+type loggedRows struct {
+	rows    *sql.Rows
+	columns []*sql.ColumnType
+}
+
+func (r *loggedRows) Columns() []string {
+	columns, _ := r.rows.Columns()
+	return columns
+}
+
+func (r *loggedRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *loggedRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	values := make([]any, len(dest))
+	for i := range values {
+		values[i] = &dest[i]
+	}
+	return r.rows.Scan(values...)
+}
+
+func (r *loggedRows) columnType(index int) *sql.ColumnType {
+	if r.columns == nil {
+		r.columns, _ = r.rows.ColumnTypes()
+	}
+	if index < len(r.columns) {
+		return r.columns[index]
+	}
+	return nil
+}
+
+func (r *loggedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if column := r.columnType(index); column != nil {
+		return column.DatabaseTypeName()
+	}
+	return ""
+}
+
+func (r *loggedRows) ColumnTypeLength(index int) (int64, bool) {
+	if column := r.columnType(index); column != nil {
+		return column.Length()
+	}
+	return 0, false
+}
+
+func (r *loggedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if column := r.columnType(index); column != nil {
+		return column.Nullable()
+	}
+	return false, false
+}
+
+func (r *loggedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if column := r.columnType(index); column != nil {
+		return column.DecimalSize()
+	}
+	return 0, 0, false
+}
+
+func (r *loggedRows) ColumnTypeScanType(index int) reflect.Type {
+	if column := r.columnType(index); column != nil && column.ScanType() != nil {
+		return column.ScanType()
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func namedArgs(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+		}
+	}
+	return values
+}
+
+func valueArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+func rowsAffected(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return rows
+}
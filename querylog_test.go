@@ -0,0 +1,163 @@
+package bucharest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newQueryLogContext(t *testing.T, options *QueryLogOptions) (Context, sqlmock.Sqlmock, *test.Hook) {
+	ctx, mock := newMockContext(t)
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	ctx.Update(&ContextOptions{Logrus: logger, QueryLog: options})
+	return ctx, mock, hook
+}
+
+func TestQueryLogSQLHandle(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour})
+	ctx.SetValue(RequestIDKey, "request-1")
+
+	mock.ExpectExec("UPDATE users SET password = $1 WHERE id = $2").WithArgs("hunter2", 1).WillReturnResult(sqlmock.NewResult(0, 3))
+	_, err := ctx.SQLHandle().ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", "hunter2", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.DebugLevel, entry.Level)
+	assert.Equal(t, "query", entry.Message)
+	assert.Equal(t, "sql", entry.Data["source"])
+	assert.Equal(t, "UPDATE users SET password = $1 WHERE id = $2", entry.Data["sql"])
+	assert.Equal(t, []string{RedactedValue, RedactedValue}, entry.Data["args"])
+	assert.Equal(t, int64(3), entry.Data["rows"])
+	assert.Equal(t, "request-1", entry.Data["request_id"])
+	assert.Contains(t, entry.Data["caller"], "querylog_test.go")
+	assert.IsType(t, time.Duration(0), entry.Data["duration"])
+}
+
+func TestQueryLogSQLXHandle(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour})
+
+	mock.ExpectQuery("SELECT name FROM users WHERE id = $1").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("alice"))
+	var name string
+	assert.NoError(t, ctx.SQLXHandle().GetContext(ctx, &name, "SELECT name FROM users WHERE id = $1", 1))
+	assert.Equal(t, "alice", name)
+
+	assert.Len(t, hook.AllEntries(), 1)
+	entry := hook.LastEntry()
+	assert.Equal(t, "sqlx", entry.Data["source"])
+	assert.Equal(t, int64(-1), entry.Data["rows"])
+	assert.NotContains(t, entry.Data, "request_id")
+	assert.Contains(t, entry.Data["caller"], "querylog_test.go")
+}
+
+func TestQueryLogGORM(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour})
+	ctx.SetValue(RequestIDKey, "request-1")
+
+	mock.ExpectExec("UPDATE users SET password = $1").WithArgs("hunter2").WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.NoError(t, ctx.GORM().Exec("UPDATE users SET password = ?", "hunter2").Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entry := hook.LastEntry()
+	assert.Equal(t, "gorm", entry.Data["source"])
+	assert.Equal(t, "UPDATE users SET password = $1", entry.Data["sql"])
+	assert.Equal(t, []string{RedactedValue}, entry.Data["args"])
+	assert.Equal(t, int64(2), entry.Data["rows"])
+	assert.Equal(t, "request-1", entry.Data["request_id"])
+	assert.Contains(t, entry.Data["caller"], "querylog_test.go")
+}
+
+func TestQueryLogSQL(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour})
+	ctx.SetValue(RequestIDKey, "request-1")
+
+	mock.ExpectExec("DELETE FROM users WHERE id = $1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err := ctx.SQL().ExecContext(ctx, "DELETE FROM users WHERE id = $1", 1)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT name FROM users WHERE id = $1").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("bob"))
+	var name string
+	assert.NoError(t, ctx.SQLX().GetContext(ctx, &name, "SELECT name FROM users WHERE id = $1", 2))
+	assert.Equal(t, "bob", name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entries := hook.AllEntries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "sql", entries[0].Data["source"])
+	assert.Equal(t, "DELETE FROM users WHERE id = $1", entries[0].Data["sql"])
+	assert.Equal(t, int64(1), entries[0].Data["rows"])
+	assert.Equal(t, "request-1", entries[0].Data["request_id"])
+	assert.Contains(t, entries[0].Data["caller"], "querylog_test.go")
+	assert.Equal(t, "sqlx", entries[1].Data["source"])
+	assert.Equal(t, "SELECT name FROM users WHERE id = $1", entries[1].Data["sql"])
+	assert.Same(t, ctx.SQL(), ctx.SQL())
+}
+
+func TestQueryLogSlowAndFailedQueries(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Nanosecond})
+
+	mock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err := ctx.SQLHandle().ExecContext(ctx, "DELETE FROM users")
+	assert.NoError(t, err)
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "slow query", entry.Message)
+	assert.Equal(t, true, entry.Data["slow"])
+	assert.NotContains(t, entry.Data, "args")
+
+	queryErr := errors.New("relation does not exist")
+	mock.ExpectQuery("SELECT * FROM missing").WillReturnError(queryErr)
+	_, err = ctx.SQLHandle().QueryContext(ctx, "SELECT * FROM missing")
+	assert.ErrorIs(t, err, queryErr)
+	entry = hook.LastEntry()
+	assert.Equal(t, logrus.ErrorLevel, entry.Level)
+	assert.Equal(t, "query failed", entry.Message)
+	assert.Equal(t, queryErr, entry.Data[logrus.ErrorKey])
+}
+
+func TestQueryLogSlowOnly(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour, SlowOnly: true})
+
+	mock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err := ctx.SQLHandle().ExecContext(ctx, "DELETE FROM users")
+	assert.NoError(t, err)
+	assert.Empty(t, hook.AllEntries())
+}
+
+func TestQueryLogInTransaction(t *testing.T) {
+	ctx, mock, hook := newQueryLogContext(t, &QueryLogOptions{SlowThreshold: time.Hour})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+	assert.NoError(t, WithTx(ctx, func(txCtx Context) error {
+		if _, err := txCtx.SQLHandle().ExecContext(txCtx, "DELETE FROM users"); err != nil {
+			return err
+		}
+		return txCtx.GORM().Exec("DELETE FROM sessions").Error
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entries := hook.AllEntries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(4), entries[0].Data["rows"])
+	assert.Equal(t, "gorm", entries[1].Data["source"])
+	assert.Equal(t, int64(5), entries[1].Data["rows"])
+}
+
+func TestQueryLogDisabled(t *testing.T) {
+	ctx, _, _ := newQueryLogContext(t, nil)
+	db, err := ctx.GORM().DB()
+	assert.NoError(t, err)
+	assert.Same(t, db, ctx.SQL())
+	assert.Equal(t, ctx.SQL(), ctx.SQLHandle())
+	assert.Equal(t, ctx.SQLX(), ctx.SQLXHandle())
+}
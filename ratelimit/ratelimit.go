@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+)
+
+const DefaultPrefix = "ratelimit:"
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+var ErrInvalidLimit = errors.New("a rate limit needs Requests above zero and a Period of at least a millisecond")
+
+type Algorithm int
+
+const (
+	FixedWindow Algorithm = iota
+	SlidingWindow
+	TokenBucket
+)
+
+// Limit allows Requests per Period. A token bucket holds Requests tokens and
+// refills them evenly over Period, so it also allows bursts of Requests.
+type Limit struct {
+	Requests  int
+	Period    time.Duration
+	Algorithm Algorithm
+}
+
+func (l Limit) valid() bool {
+	return l.Requests > 0 && l.Period >= time.Millisecond
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the limit is fully available again.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// KeyFunc names the client a request is counted against. An empty key falls
+// back to the client IP.
+type KeyFunc func(ctx bucharest.HTTPContext) string
+
+func ByIP(ctx bucharest.HTTPContext) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// ByHeader counts requests per value of header, such as an API key.
+func ByHeader(header string) KeyFunc {
+	return func(ctx bucharest.HTTPContext) string {
+		if value := ctx.GetHeader(header); value != "" {
+			return "header:" + value
+		}
+		return ""
+	}
+}
+
+// ByUser counts requests per user ID that an authentication middleware stored
+// under key.
+func ByUser(key string) KeyFunc {
+	return func(ctx bucharest.HTTPContext) string {
+		if user, ok := ctx.Get(key); ok && user != nil {
+			return "user:" + fmt.Sprint(user)
+		}
+		return ""
+	}
+}
+
+type Options struct {
+	Limit Limit
+	Key   KeyFunc
+	// Store defaults to Redis when the context has a client and to a MemoryStore
+	// otherwise.
+	Store  Store
+	Prefix string
+	// Route separates the counters of routes that share a key, and defaults to
+	// the path the route was registered with.
+	Route string
+	// OnError is called when the store fails, and the request is let through.
+	// A nil OnError logs a warning with the request ID.
+	OnError func(err error)
+}
+
+type limiter struct {
+	options *Options
+	memory  *MemoryStore
+}
+
+// Middleware limits the requests of each client to a route. Register one per
+// route, or per group of routes, that needs its own limit. It panics with
+// ErrInvalidLimit when options has no valid Limit.
+func Middleware(options *Options) bucharest.HandlerFunc {
+	if options == nil || !options.Limit.valid() {
+		panic(ErrInvalidLimit)
+	}
+	o := *options
+	if o.Key == nil {
+		o.Key = ByIP
+	}
+	if o.Prefix == "" {
+		o.Prefix = DefaultPrefix
+	}
+	l := &limiter{options: &o, memory: NewMemoryStore()}
+	return l.handle
+}
+
+func (l *limiter) handle(ctx bucharest.HTTPContext) bucharest.HTTPError {
+	key := l.options.Key(ctx)
+	if key == "" {
+		key = ByIP(ctx)
+	}
+	route := l.options.Route
+	if route == "" {
+		route = ctx.FullPath()
+	}
+
+	result, err := l.store(ctx).Allow(ctx, l.options.Prefix+route+":"+key, l.options.Limit)
+	if err != nil {
+		if l.options.OnError != nil {
+			l.options.OnError(err)
+		} else {
+			bucharest.Logger(ctx).WithError(err).Warn("rate limit store failed")
+		}
+		ctx.Next()
+		return nil
+	}
+
+	limit := l.options.Limit
+	ctx.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.Header("RateLimit-Reset", seconds(result.Reset))
+	ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Period)))
+	if !result.Allowed {
+		ctx.Header("Retry-After", seconds(result.RetryAfter))
+		ctx.Abort()
+		return bucharest.NewTooManyRequestsError(ErrRateLimited)
+	}
+	ctx.Next()
+	return nil
+}
+
+func (l *limiter) store(ctx bucharest.Context) Store {
+	if l.options.Store != nil {
+		return l.options.Store
+	}
+	if bucharest.HasRedis(ctx) {
+		return NewRedisStore(ctx.UniversalRedis())
+	}
+	return l.memory
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
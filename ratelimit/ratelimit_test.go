@@ -0,0 +1,139 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/ratelimit"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter(ctx bucharest.Context, options *Options, before ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(before...)
+	limit := bucharest.NewGinHandlerFunc(ctx, Middleware(options))
+	ok := bucharest.NewGinHandlerFunc(ctx, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		ctx.String(http.StatusOK, "ok")
+		return nil
+	})
+	g.GET("/a", limit, ok)
+	g.GET("/b", limit, ok)
+	return g
+}
+
+func serve(g *gin.Engine, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	return res
+}
+
+func TestMiddleware(t *testing.T) {
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Limit: Limit{Requests: 2, Period: time.Hour}})
+
+	res := serve(g, "/a")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, res.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=3600", res.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, res.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	res = serve(g, "/a")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"message":"rate limit exceeded"}`, res.Body.String())
+
+	assert.Equal(t, http.StatusOK, serve(g, "/b").Code)
+}
+
+func TestMiddlewareRoute(t *testing.T) {
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Limit: Limit{Requests: 1, Period: time.Hour}, Route: "shared"})
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(g, "/b").Code)
+}
+
+func TestMiddlewareRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	g := newRouter(ctx, &Options{Limit: Limit{Requests: 1, Period: time.Hour, Algorithm: TokenBucket}})
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	assert.True(t, mr.Exists(DefaultPrefix+"/a:ip:192.0.2.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(g, "/a").Code)
+}
+
+func TestByHeader(t *testing.T) {
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Limit: Limit{Requests: 1, Period: time.Hour}, Key: ByHeader("X-API-Key")})
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a", "X-API-Key", "one").Code)
+	assert.Equal(t, http.StatusOK, serve(g, "/a", "X-API-Key", "two").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(g, "/a", "X-API-Key", "one").Code)
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(g, "/a").Code)
+}
+
+func TestByUser(t *testing.T) {
+	setUser := func(g *gin.Context) {
+		if user := g.GetHeader("X-User"); user != "" {
+			g.Set("userID", user)
+		}
+	}
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Limit: Limit{Requests: 1, Period: time.Hour}, Key: ByUser("userID")}, setUser)
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a", "X-User", "42").Code)
+	assert.Equal(t, http.StatusOK, serve(g, "/a", "X-User", "43").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(g, "/a", "X-User", "42").Code)
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestMiddlewareStoreError(t *testing.T) {
+	var reported error
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{
+		Limit:   Limit{Requests: 1, Period: time.Hour},
+		Store:   failingStore{},
+		OnError: func(err error) { reported = err },
+	})
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	assert.EqualError(t, reported, "connection refused")
+}
+
+func TestMiddlewareStoreErrorLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	g := newRouter(bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger}), &Options{
+		Limit: Limit{Requests: 1, Period: time.Hour},
+		Store: failingStore{},
+	})
+
+	assert.Equal(t, http.StatusOK, serve(g, "/a").Code)
+	assert.Equal(t, "rate limit store failed", hook.LastEntry().Message)
+}
+
+func TestMiddlewareInvalidLimit(t *testing.T) {
+	utils.AssertPanic(t, func() { Middleware(nil) }, ErrInvalidLimit)
+	utils.AssertPanic(t, func() { Middleware(&Options{Limit: Limit{Period: time.Minute}}) }, ErrInvalidLimit)
+	utils.AssertPanic(t, func() { Middleware(&Options{Limit: Limit{Requests: 10}}) }, ErrInvalidLimit)
+}
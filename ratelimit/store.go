@@ -0,0 +1,262 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call("incr", KEYS[1])
+if count == 1 then
+	redis.call("pexpire", KEYS[1], ARGV[1])
+end
+return count`)
+
+var slidingWindowScript = redis.NewScript(`
+local current = tonumber(redis.call("get", KEYS[1]) or "0")
+local previous = tonumber(redis.call("get", KEYS[2]) or "0")
+if previous * tonumber(ARGV[2]) + current >= tonumber(ARGV[1]) then
+	return {0, current, previous}
+end
+current = redis.call("incr", KEYS[1])
+if current == 1 then
+	redis.call("pexpire", KEYS[1], ARGV[3])
+end
+return {1, current, previous}`)
+
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("hmget", KEYS[1], "tokens", "at")
+local tokens = tonumber(state[1]) or capacity
+local at = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - at) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "at", now)
+redis.call("pexpire", KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}`)
+
+// RedisStore shares the counters between every instance. Windows are keyed by
+// the instance clocks, so keep them in sync. The keys of a sliding window share
+// a hash tag so that it works on a Redis Cluster.
+type RedisStore struct {
+	Client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if !limit.valid() {
+		return Result{}, ErrInvalidLimit
+	}
+	now := time.Now()
+	switch limit.Algorithm {
+	case SlidingWindow:
+		window, elapsed := windowOf(now, limit.Period)
+		weight := 1 - float64(elapsed)/float64(limit.Period)
+		keys := []string{windowKey(key, window), windowKey(key, window-1)}
+		values, err := slidingWindowScript.Run(ctx, s.Client, keys, limit.Requests, strconv.FormatFloat(weight, 'f', -1, 64), (2 * limit.Period).Milliseconds()).Int64Slice()
+		if err != nil {
+			return Result{}, err
+		}
+		return slidingWindowResult(limit, values[0] == 1, values[1], values[2], elapsed), nil
+	case TokenBucket:
+		rate := float64(limit.Requests) / float64(limit.Period.Milliseconds())
+		values, err := tokenBucketScript.Run(ctx, s.Client, []string{key}, limit.Requests, strconv.FormatFloat(rate, 'f', -1, 64), now.UnixMilli(), limit.Period.Milliseconds()).Slice()
+		if err != nil {
+			return Result{}, err
+		}
+		allowed, _ := values[0].(int64)
+		tokens, err := strconv.ParseFloat(values[1].(string), 64)
+		if err != nil {
+			return Result{}, err
+		}
+		return tokenBucketResult(limit, allowed == 1, tokens), nil
+	default:
+		window, elapsed := windowOf(now, limit.Period)
+		count, err := fixedWindowScript.Run(ctx, s.Client, []string{windowKey(key, window)}, limit.Period.Milliseconds()).Int64()
+		if err != nil {
+			return Result{}, err
+		}
+		return fixedWindowResult(limit, count, elapsed), nil
+	}
+}
+
+// MemoryStore keeps the counters in process, so every instance enforces the
+// limit on its own. Expired counters are swept every sweepInterval calls.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+	buckets  map[string]memoryBucket
+	calls    int
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	at        time.Time
+	expiresAt time.Time
+}
+
+const sweepInterval = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]memoryCounter), buckets: make(map[string]memoryBucket)}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	if !limit.valid() {
+		return Result{}, ErrInvalidLimit
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls++; s.calls%sweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	switch limit.Algorithm {
+	case SlidingWindow:
+		window, elapsed := windowOf(now, limit.Period)
+		current := s.counter(windowKey(key, window), now)
+		previous := s.counter(windowKey(key, window-1), now)
+		weight := 1 - float64(elapsed)/float64(limit.Period)
+		allowed := float64(previous)*weight+float64(current) < float64(limit.Requests)
+		if allowed {
+			current = s.increment(windowKey(key, window), now, 2*limit.Period)
+		}
+		return slidingWindowResult(limit, allowed, current, previous, elapsed), nil
+	case TokenBucket:
+		rate := float64(limit.Requests) / float64(limit.Period)
+		bucket, ok := s.buckets[key]
+		if !ok || now.After(bucket.expiresAt) {
+			bucket = memoryBucket{tokens: float64(limit.Requests), at: now}
+		}
+		bucket.tokens = math.Min(float64(limit.Requests), bucket.tokens+float64(max(0, now.Sub(bucket.at)))*rate)
+		allowed := bucket.tokens >= 1
+		if allowed {
+			bucket.tokens--
+		}
+		bucket.at = now
+		bucket.expiresAt = now.Add(limit.Period)
+		s.buckets[key] = bucket
+		return tokenBucketResult(limit, allowed, bucket.tokens), nil
+	default:
+		window, elapsed := windowOf(now, limit.Period)
+		count := s.increment(windowKey(key, window), now, limit.Period)
+		return fixedWindowResult(limit, count, elapsed), nil
+	}
+}
+
+func (s *MemoryStore) counter(key string, now time.Time) int64 {
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		return 0
+	}
+	return counter.count
+}
+
+func (s *MemoryStore) increment(key string, now time.Time, ttl time.Duration) int64 {
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.expiresAt) {
+		counter = memoryCounter{expiresAt: now.Add(ttl)}
+	}
+	counter.count++
+	s.counters[key] = counter
+	return counter.count
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, counter := range s.counters {
+		if now.After(counter.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+	for key, bucket := range s.buckets {
+		if now.After(bucket.expiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func windowOf(now time.Time, period time.Duration) (int64, time.Duration) {
+	window := now.UnixNano() / int64(period)
+	return window, time.Duration(now.UnixNano() - window*int64(period))
+}
+
+func windowKey(key string, window int64) string {
+	return "{" + key + "}:" + strconv.FormatInt(window, 10)
+}
+
+func fixedWindowResult(limit Limit, count int64, elapsed time.Duration) Result {
+	result := Result{
+		Allowed:   count <= int64(limit.Requests),
+		Limit:     limit.Requests,
+		Remaining: max(0, limit.Requests-int(count)),
+		Reset:     limit.Period - elapsed,
+	}
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	return result
+}
+
+// slidingWindowResult weighs the previous window by how much of it still
+// overlaps the sliding window, as Cloudflare's sliding window counter does.
+func slidingWindowResult(limit Limit, allowed bool, current, previous int64, elapsed time.Duration) Result {
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	used := int(math.Ceil(float64(previous)*weight)) + int(current)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(0, limit.Requests-used),
+		Reset:     limit.Period - elapsed,
+	}
+	if allowed {
+		return result
+	}
+	// Wait until enough of the previous window has slid out, or for the next
+	// window when the current one alone is over the limit.
+	free := float64(int64(limit.Requests) - current)
+	if previous > 0 && free > 0 {
+		result.RetryAfter = time.Duration(float64(limit.Period)*(1-free/float64(previous))) - elapsed + time.Millisecond
+	} else {
+		result.RetryAfter = result.Reset
+	}
+	result.RetryAfter = max(result.RetryAfter, time.Millisecond)
+	return result
+}
+
+func tokenBucketResult(limit Limit, allowed bool, tokens float64) Result {
+	perToken := limit.Period / time.Duration(limit.Requests)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return result
+}
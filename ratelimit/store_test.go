@@ -0,0 +1,100 @@
+package ratelimit_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/ratelimit"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func stores(t *testing.T) (map[string]Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}, mr
+}
+
+func allowN(t *testing.T, store Store, key string, limit Limit, n int) []Result {
+	results := make([]Result, n)
+	for i := range results {
+		result, err := store.Allow(context.Background(), key, limit)
+		assert.NoError(t, err)
+		results[i] = result
+	}
+	return results
+}
+
+func TestStores(t *testing.T) {
+	all, _ := stores(t)
+	for name, store := range all {
+		for _, algorithm := range []Algorithm{FixedWindow, SlidingWindow, TokenBucket} {
+			limit := Limit{Requests: 3, Period: time.Hour, Algorithm: algorithm}
+			results := allowN(t, store, "client:"+strconv.Itoa(int(algorithm)), limit, 4)
+
+			for i, result := range results[:3] {
+				assert.True(t, result.Allowed, name, algorithm)
+				assert.Equal(t, 3, result.Limit)
+				assert.Equal(t, 2-i, result.Remaining, name, algorithm)
+				assert.Zero(t, result.RetryAfter)
+			}
+			denied := results[3]
+			assert.False(t, denied.Allowed, name, algorithm)
+			assert.Equal(t, 0, denied.Remaining)
+			assert.Greater(t, denied.RetryAfter, time.Duration(0), name, algorithm)
+			assert.LessOrEqual(t, denied.RetryAfter, time.Hour, name, algorithm)
+		}
+	}
+}
+
+func TestStoresInvalidLimit(t *testing.T) {
+	all, _ := stores(t)
+	for name, store := range all {
+		for _, limit := range []Limit{{Period: time.Hour}, {Requests: 1}, {Requests: 1, Period: time.Microsecond, Algorithm: TokenBucket}} {
+			_, err := store.Allow(context.Background(), "client", limit)
+			assert.ErrorIs(t, err, ErrInvalidLimit, name)
+		}
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	all, _ := stores(t)
+	for name, store := range all {
+		limit := Limit{Requests: 2, Period: 100 * time.Millisecond, Algorithm: TokenBucket}
+		results := allowN(t, store, "client", limit, 3)
+		assert.False(t, results[2].Allowed, name)
+		assert.InDelta(t, 50*time.Millisecond, results[2].RetryAfter, float64(10*time.Millisecond), name)
+
+		time.Sleep(60 * time.Millisecond)
+		assert.True(t, allowN(t, store, "client", limit, 1)[0].Allowed, name)
+	}
+}
+
+func TestSlidingWindowCountsPreviousWindow(t *testing.T) {
+	all, mr := stores(t)
+	store := all["redis"]
+	limit := Limit{Requests: 5, Period: time.Hour, Algorithm: SlidingWindow}
+	window := time.Now().UnixNano() / int64(time.Hour)
+	mr.Set("{client}:"+strconv.FormatInt(window-1, 10), "1000000")
+
+	result := allowN(t, store, "client", limit, 1)[0]
+	assert.False(t, result.Allowed)
+	assert.Greater(t, result.RetryAfter, time.Duration(0))
+	assert.False(t, mr.Exists("{client}:"+strconv.FormatInt(window, 10)))
+}
+
+func TestRedisStoreKeys(t *testing.T) {
+	all, mr := stores(t)
+	window := time.Now().UnixNano() / int64(time.Hour)
+
+	allowN(t, all["redis"], "client", Limit{Requests: 3, Period: time.Hour}, 2)
+	count, err := mr.Get("{client}:" + strconv.FormatInt(window, 10))
+	assert.NoError(t, err)
+	assert.Equal(t, "2", count)
+	assert.Equal(t, time.Hour, mr.TTL("{client}:"+strconv.FormatInt(window, 10)))
+}
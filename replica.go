@@ -0,0 +1,180 @@
+package bucharest
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+)
+
+type ReplicaPolicy int
+
+const (
+	RoundRobin ReplicaPolicy = iota
+	LeastLatency
+)
+
+type Replica struct {
+	GORM *gorm.DB
+	SQL  *sql.DB
+	SQLX *sqlx.DB
+}
+
+type replica struct {
+	Replica
+	unhealthy atomic.Bool
+	latency   atomic.Int64
+}
+
+type replicaSet struct {
+	replicas []*replica
+	policy   ReplicaPolicy
+	next     atomic.Uint64
+
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplicaSet(replicas []Replica, policy ReplicaPolicy) *replicaSet {
+	if len(replicas) == 0 {
+		return nil
+	}
+	set := &replicaSet{policy: policy}
+	for _, r := range replicas {
+		set.replicas = append(set.replicas, &replica{Replica: r})
+	}
+	return set
+}
+
+func (set *replicaSet) pick() *replica {
+	healthy := make([]*replica, 0, len(set.replicas))
+	for _, r := range set.replicas {
+		if !r.unhealthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if set.policy == LeastLatency {
+		fastest := healthy[0]
+		for _, r := range healthy[1:] {
+			if r.latency.Load() < fastest.latency.Load() {
+				fastest = r
+			}
+		}
+		return fastest
+	}
+	return healthy[(set.next.Add(1)-1)%uint64(len(healthy))]
+}
+
+func (set *replicaSet) check(ctx context.Context, timeout time.Duration) {
+	for _, r := range set.replicas {
+		db := r.db()
+		if db == nil {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := db.PingContext(pingCtx)
+		cancel()
+		r.latency.Store(int64(time.Since(start)))
+		r.unhealthy.Store(err != nil)
+	}
+}
+
+func (set *replicaSet) start(ctx context.Context, interval time.Duration) {
+	set.interval = interval
+	set.done = make(chan struct{})
+	go set.watch(ctx, interval)
+}
+
+func (set *replicaSet) stop() {
+	if set.done != nil {
+		set.stopOnce.Do(func() { close(set.done) })
+	}
+}
+
+func (set *replicaSet) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-set.done:
+			return
+		case <-ticker.C:
+			set.check(ctx, interval)
+		}
+	}
+}
+
+func (r *replica) db() *sql.DB {
+	if r.SQL != nil {
+		return r.SQL
+	}
+	if r.SQLX != nil {
+		return r.SQLX.DB
+	}
+	if r.GORM != nil {
+		if db, err := r.GORM.DB(); err == nil {
+			return db
+		}
+	}
+	return nil
+}
+
+func (ctx *BuchatrestContext) ReadOnly() Context {
+	return ctx.readOnly(ctx)
+}
+
+func (ctx *BuchatrestContext) readOnly(parent Context) Context {
+	ctx.guardTenant()
+	if ctx.tx != nil || ctx.replicas == nil {
+		return parent
+	}
+	r := ctx.replicas.pick()
+	if r == nil {
+		return parent
+	}
+
+	child := ctx.derive(parent)
+	child.primary = ctx
+	if ctx.primary != nil {
+		child.primary = ctx.primary
+	}
+	if r.GORM != nil {
+		child.gorm_ = r.GORM
+	}
+	if r.SQL != nil {
+		child.sql_ = r.SQL
+	}
+	if r.SQLX != nil {
+		child.sqlx_ = r.SQLX
+	}
+	return child
+}
+
+// CheckReplicas pings every replica once, ejecting the ones that fail until a
+// later check succeeds. ContextOptions.ReplicaHealthCheckInterval runs it periodically.
+func CheckReplicas(ctx Context) {
+	if replicas := baseOf(ctx).replicas; replicas != nil {
+		replicas.check(ctx, DefaultPingTimeout)
+	}
+}
+
+// StopReplicaHealthCheck stops the periodic checks started by
+// ContextOptions.ReplicaHealthCheckInterval, which otherwise run until Parent
+// is done.
+func StopReplicaHealthCheck(ctx Context) {
+	if replicas := baseOf(ctx).replicas; replicas != nil {
+		replicas.stop()
+	}
+}
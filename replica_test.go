@@ -0,0 +1,188 @@
+package bucharest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReplica(t *testing.T) (Replica, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	return Replica{SQL: db, SQLX: sqlx.NewDb(db, "sqlmock")}, mock
+}
+
+func TestReadOnlyRoundRobin(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	first, _ := newReplica(t)
+	second, _ := newReplica(t)
+
+	ctx := NewContextWithOptions(&ContextOptions{SQL: primary, Replicas: []Replica{first, second}})
+	assert.Same(t, first.SQL, ctx.ReadOnly().SQL())
+	assert.Same(t, second.SQL, ctx.ReadOnly().SQL())
+	assert.Same(t, first.SQL, ctx.ReadOnly().SQL())
+	assert.Same(t, first.SQLX, ctx.ReadOnly().ReadOnly().SQLX())
+	assert.Same(t, primary, ctx.SQL())
+
+	utils.AssertPanic(t, func() { ctx.ReadOnly().GORM() }, ErrNoGORM)
+}
+
+func TestReadOnlyWithoutReplicas(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	ctx := NewContextWithOptions(&ContextOptions{SQL: primary})
+	assert.Same(t, ctx, ctx.ReadOnly())
+}
+
+func TestReadOnlyEjectsUnhealthyReplicas(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	healthy, healthyMock := newReplica(t)
+	unhealthy, unhealthyMock := newReplica(t)
+
+	ctx := NewContextWithOptions(&ContextOptions{SQL: primary, Replicas: []Replica{unhealthy, healthy}})
+
+	healthyMock.ExpectPing()
+	unhealthyMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	CheckReplicas(ctx)
+	for i := 0; i < 3; i++ {
+		assert.Same(t, healthy.SQL, ctx.ReadOnly().SQL())
+	}
+
+	healthyMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	unhealthyMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	CheckReplicas(ctx)
+	assert.Same(t, primary, ctx.ReadOnly().SQL())
+
+	healthyMock.ExpectPing()
+	unhealthyMock.ExpectPing()
+	CheckReplicas(ctx)
+	assert.NotSame(t, ctx.ReadOnly().SQL(), ctx.ReadOnly().SQL())
+	assert.NoError(t, healthyMock.ExpectationsWereMet())
+	assert.NoError(t, unhealthyMock.ExpectationsWereMet())
+}
+
+func TestReadOnlyLeastLatency(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	slow, slowMock := newReplica(t)
+	fast, fastMock := newReplica(t)
+
+	ctx := NewContextWithOptions(&ContextOptions{SQL: primary, Replicas: []Replica{slow, fast}, ReplicaPolicy: LeastLatency})
+	slowMock.ExpectPing().WillDelayFor(20 * time.Millisecond)
+	fastMock.ExpectPing()
+	CheckReplicas(ctx)
+
+	for i := 0; i < 3; i++ {
+		assert.Same(t, fast.SQL, ctx.ReadOnly().SQL())
+	}
+}
+
+func TestReadOnlyHealthCheckInterval(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	replica, mock := newReplica(t)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx := NewContextWithOptions(&ContextOptions{
+		Parent:                     parent,
+		SQL:                        primary,
+		Replicas:                   []Replica{replica},
+		ReplicaHealthCheckInterval: 10 * time.Millisecond,
+	})
+
+	utils.RunUntil(func() bool { return ctx.ReadOnly().SQL() == primary }, time.Second)
+	assert.Same(t, primary, ctx.ReadOnly().SQL())
+}
+
+func TestReadOnlyHealthCheckStop(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	replica, mock := newReplica(t)
+
+	ctx := NewContextWithOptions(&ContextOptions{
+		SQL:                        primary,
+		Replicas:                   []Replica{replica},
+		ReplicaHealthCheckInterval: 10 * time.Millisecond,
+	})
+	StopReplicaHealthCheck(ctx)
+	StopReplicaHealthCheck(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Same(t, replica.SQL, ctx.ReadOnly().SQL())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadOnlyHealthCheckAfterUpdate(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	replaced, replacedMock := newReplica(t)
+	replica, mock := newReplica(t)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	ctx := NewContextWithOptions(&ContextOptions{
+		SQL:                        primary,
+		Replicas:                   []Replica{replaced},
+		ReplicaHealthCheckInterval: 10 * time.Millisecond,
+	})
+	ctx.Update(&ContextOptions{Replicas: []Replica{replica}})
+	defer StopReplicaHealthCheck(ctx)
+
+	utils.RunUntil(func() bool { return ctx.ReadOnly().SQL() == primary }, time.Second)
+	assert.Same(t, primary, ctx.ReadOnly().SQL())
+	assert.NoError(t, replacedMock.ExpectationsWereMet())
+}
+
+func TestReadOnlyRoutesTransactionsToPrimary(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	replica, replicaMock := newReplica(t)
+	ctx.Update(&ContextOptions{Replicas: []Replica{replica}})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	readOnly := ctx.ReadOnly()
+	assert.Same(t, replica.SQL, readOnly.SQL())
+	err := WithTx(readOnly, func(txCtx Context) error {
+		assert.Same(t, txCtx, txCtx.ReadOnly())
+		assert.Same(t, ctx.SQL(), txCtx.SQL())
+		_, err := txCtx.ReadOnly().SQLHandle().ExecContext(txCtx, "UPDATE foo SET bar = $1", 1)
+		return err
+	})
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(t, WithTx(readOnly.ReadOnly(), func(txCtx Context) error { return nil }))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestReadOnlyHTTPContext(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	replica, _ := newReplica(t)
+	ctx := NewContextWithOptions(&ContextOptions{SQL: primary, Replicas: []Replica{replica}})
+
+	var readOnly *sql.DB
+	serveHandler(ctx, func(h HTTPContext) HTTPError {
+		h.Set("foo", "bar")
+		ro := h.ReadOnly()
+		readOnly = ro.SQL()
+		assert.Equal(t, "bar", ro.Value("foo"))
+		return nil
+	})
+	assert.Same(t, replica.SQL, readOnly)
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Operator string
+
+const (
+	Equal              Operator = "eq"
+	NotEqual           Operator = "ne"
+	GreaterThan        Operator = "gt"
+	GreaterThanOrEqual Operator = "gte"
+	LessThan           Operator = "lt"
+	LessThanOrEqual    Operator = "lte"
+	Like               Operator = "like"
+	In                 Operator = "in"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+var filterPattern = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+type Filter struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+	Offset  int
+	Cursor  string
+}
+
+// ParseQuery reads filter[field]=value, filter[field][op]=value,
+// sort=-field,field, limit, offset and cursor. Fields are checked against the
+// repository's columns when the query runs.
+func ParseQuery(values url.Values) (*Query, error) {
+	query := &Query{}
+	for key, vals := range values {
+		match := filterPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		operator := Operator(match[2])
+		if operator == "" {
+			operator = Equal
+		}
+		if !operator.valid() {
+			return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, operator)
+		}
+		for _, value := range vals {
+			query.Filters = append(query.Filters, Filter{Field: match[1], Operator: operator, Value: value})
+		}
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			desc := strings.HasPrefix(field, "-")
+			query.Sort = append(query.Sort, Sort{Field: strings.TrimPrefix(field, "-"), Desc: desc})
+		}
+	}
+
+	var err error
+	if query.Limit, err = parseInt(values, "limit"); err != nil {
+		return nil, err
+	}
+	if query.Offset, err = parseInt(values, "offset"); err != nil {
+		return nil, err
+	}
+	query.Cursor = values.Get("cursor")
+	return query, nil
+}
+
+func (operator Operator) valid() bool {
+	switch operator {
+	case Equal, NotEqual, GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual, Like, In:
+		return true
+	}
+	return false
+}
+
+func parseInt(values url.Values, key string) (int, error) {
+	value := values.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: %s must be a positive number", ErrInvalidQuery, key)
+	}
+	return i, nil
+}
@@ -0,0 +1,34 @@
+package repository_test
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+
+	. "github.com/argonlab-io/bucharest/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("filter[status]=active&filter[age][gte]=18&sort=-created_at,name&limit=10&offset=20&cursor=abc&page=1")
+	query, err := ParseQuery(values)
+	assert.NoError(t, err)
+
+	sort.Slice(query.Filters, func(i, j int) bool { return query.Filters[i].Field < query.Filters[j].Field })
+	assert.Equal(t, []Filter{
+		{Field: "age", Operator: GreaterThanOrEqual, Value: "18"},
+		{Field: "status", Operator: Equal, Value: "active"},
+	}, query.Filters)
+	assert.Equal(t, []Sort{{Field: "created_at", Desc: true}, {Field: "name"}}, query.Sort)
+	assert.Equal(t, 10, query.Limit)
+	assert.Equal(t, 20, query.Offset)
+	assert.Equal(t, "abc", query.Cursor)
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, raw := range []string{"filter[status][regex]=.*", "limit=ten", "offset=-1"} {
+		values, _ := url.ParseQuery(raw)
+		_, err := ParseQuery(values)
+		assert.ErrorIs(t, err, ErrInvalidQuery, raw)
+	}
+}
@@ -0,0 +1,352 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/argonlab-io/bucharest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const DefaultLimit = 20
+const MaxLimit = 100
+
+var ErrNoSoftDelete = errors.New("the model has no gorm.DeletedAt field")
+
+type Options struct {
+	// Columns maps the field names accepted in filters and sort to database
+	// columns. Anything else is rejected with ErrInvalidQuery.
+	Columns map[string]string
+	// Key is the column used to break ties in cursor pagination, "id" by default.
+	Key          string
+	DefaultSort  []Sort
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type Page[T any] struct {
+	Items      []T
+	Limit      int
+	Offset     int
+	HasMore    bool
+	NextCursor string
+}
+
+type Repository[T any] struct {
+	options *Options
+	schema  *schema.Schema
+	once    sync.Once
+	err     error
+}
+
+type order struct {
+	column string
+	desc   bool
+}
+
+func New[T any](options *Options) *Repository[T] {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Key == "" {
+		o.Key = "id"
+	}
+	if o.DefaultLimit == 0 {
+		o.DefaultLimit = DefaultLimit
+	}
+	if o.MaxLimit == 0 {
+		o.MaxLimit = MaxLimit
+	}
+	return &Repository[T]{options: o}
+}
+
+func (r *Repository[T]) Get(ctx bucharest.Context, id any) (*T, error) {
+	item := new(T)
+	if err := ctx.GORM().Where(primaryKey(id)).First(item).Error; err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *Repository[T]) Create(ctx bucharest.Context, item *T) error {
+	return ctx.GORM().Create(item).Error
+}
+
+func (r *Repository[T]) Update(ctx bucharest.Context, item *T) error {
+	return ctx.GORM().Save(item).Error
+}
+
+// Delete removes the row even when the model supports soft deletes.
+func (r *Repository[T]) Delete(ctx bucharest.Context, id any) error {
+	return affected(ctx.GORM().Unscoped().Where(primaryKey(id)).Delete(new(T)))
+}
+
+func (r *Repository[T]) SoftDelete(ctx bucharest.Context, id any) error {
+	s, err := r.parse(ctx.GORM())
+	if err != nil {
+		return err
+	}
+	if !hasDeletedAt(s) {
+		return ErrNoSoftDelete
+	}
+	return affected(ctx.GORM().Where(primaryKey(id)).Delete(new(T)))
+}
+
+func (r *Repository[T]) List(ctx bucharest.Context, query *Query) (*Page[T], error) {
+	if query == nil {
+		query = &Query{}
+	}
+	db := ctx.GORM()
+	s, err := r.parse(db)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = r.options.DefaultLimit
+	}
+	if limit > r.options.MaxLimit {
+		limit = r.options.MaxLimit
+	}
+	if query.Cursor != "" && query.Offset != 0 {
+		return nil, fmt.Errorf("%w: cursor and offset cannot be used together", ErrInvalidQuery)
+	}
+
+	conditions, err := r.filters(query.Filters)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := r.orders(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if query.Cursor != "" {
+		after, err := decodeCursor(s, orders, query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, after)
+	}
+
+	orderBy := clause.OrderBy{}
+	for _, o := range orders {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Name: o.column}, Desc: o.desc})
+	}
+
+	var items []T
+	tx := db.Model(new(T))
+	if len(conditions) > 0 {
+		tx = tx.Where(clause.And(conditions...))
+	}
+	tx = tx.Clauses(orderBy).Limit(limit + 1)
+	if query.Offset != 0 {
+		tx = tx.Offset(query.Offset)
+	}
+	if err := tx.Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	page := &Page[T]{Items: items, Limit: limit, Offset: query.Offset}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		page.NextCursor, err = encodeCursor(ctx, s, orders, &page.Items[limit-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func (r *Repository[T]) parse(db *gorm.DB) (*schema.Schema, error) {
+	r.once.Do(func() {
+		stmt := &gorm.Statement{DB: db}
+		r.err = stmt.Parse(new(T))
+		r.schema = stmt.Schema
+	})
+	return r.schema, r.err
+}
+
+func (r *Repository[T]) column(field string) (string, error) {
+	column, ok := r.options.Columns[field]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, field)
+	}
+	return column, nil
+}
+
+func (r *Repository[T]) filters(filters []Filter) ([]clause.Expression, error) {
+	conditions := make([]clause.Expression, 0, len(filters))
+	for _, filter := range filters {
+		name, err := r.column(filter.Field)
+		if err != nil {
+			return nil, err
+		}
+		column := clause.Column{Name: name}
+		switch filter.Operator {
+		case Equal, "":
+			conditions = append(conditions, clause.Eq{Column: column, Value: filter.Value})
+		case NotEqual:
+			conditions = append(conditions, clause.Neq{Column: column, Value: filter.Value})
+		case GreaterThan:
+			conditions = append(conditions, clause.Gt{Column: column, Value: filter.Value})
+		case GreaterThanOrEqual:
+			conditions = append(conditions, clause.Gte{Column: column, Value: filter.Value})
+		case LessThan:
+			conditions = append(conditions, clause.Lt{Column: column, Value: filter.Value})
+		case LessThanOrEqual:
+			conditions = append(conditions, clause.Lte{Column: column, Value: filter.Value})
+		case Like:
+			conditions = append(conditions, clause.Like{Column: column, Value: filter.Value})
+		case In:
+			values := []any{}
+			for _, value := range strings.Split(filter.Value, ",") {
+				values = append(values, value)
+			}
+			conditions = append(conditions, clause.IN{Column: column, Values: values})
+		default:
+			return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, filter.Operator)
+		}
+	}
+	return conditions, nil
+}
+
+// orders resolves the sort, falling back to DefaultSort, and always ends with
+// the key column so that the order and the cursors are stable.
+func (r *Repository[T]) orders(sorts []Sort) ([]order, error) {
+	if len(sorts) == 0 {
+		sorts = r.options.DefaultSort
+	}
+	orders := make([]order, 0, len(sorts)+1)
+	hasKey := false
+	for _, sort := range sorts {
+		column, err := r.column(sort.Field)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order{column: column, desc: sort.Desc})
+		hasKey = hasKey || column == r.options.Key
+	}
+	if !hasKey {
+		orders = append(orders, order{column: r.options.Key})
+	}
+	return orders, nil
+}
+
+// cursor is a keyset position with the sort it was made for, such as
+// ["name", "-id"], so that it cannot be reused with another sort.
+type cursor struct {
+	Sort   []string          `json:"sort"`
+	Values []json.RawMessage `json:"values"`
+}
+
+func sortOf(orders []order) []string {
+	sort := make([]string, len(orders))
+	for i, o := range orders {
+		sort[i] = o.column
+		if o.desc {
+			sort[i] = "-" + o.column
+		}
+	}
+	return sort
+}
+
+func encodeCursor[T any](ctx bucharest.Context, s *schema.Schema, orders []order, item *T) (string, error) {
+	c := cursor{Sort: sortOf(orders), Values: make([]json.RawMessage, len(orders))}
+	for i, o := range orders {
+		field := s.LookUpField(o.column)
+		if field == nil {
+			return "", fmt.Errorf("%w: %s is not a field of %s", ErrInvalidQuery, o.column, s.Name)
+		}
+		value, _ := field.ValueOf(ctx, reflect.ValueOf(item).Elem())
+		var err error
+		if c.Values[i], err = json.Marshal(value); err != nil {
+			return "", err
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor builds the keyset condition for the rows after the cursor:
+// (a > x) OR (a = x AND b > y) OR ..., with < for descending columns.
+func decodeCursor(s *schema.Schema, orders []order, encoded string) (clause.Expression, error) {
+	invalid := fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || len(c.Values) != len(orders) {
+		return nil, invalid
+	}
+	if !slices.Equal(c.Sort, sortOf(orders)) {
+		return nil, fmt.Errorf("%w: the cursor was made for another sort", ErrInvalidQuery)
+	}
+
+	values := make([]any, len(orders))
+	for i, o := range orders {
+		field := s.LookUpField(o.column)
+		if field == nil {
+			return nil, invalid
+		}
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, invalid
+		}
+		values[i] = value.Elem().Interface()
+	}
+
+	or := make([]clause.Expression, 0, len(orders))
+	for i, o := range orders {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: clause.Column{Name: orders[j].column}, Value: values[j]})
+		}
+		if o.desc {
+			and = append(and, clause.Lt{Column: clause.Column{Name: o.column}, Value: values[i]})
+		} else {
+			and = append(and, clause.Gt{Column: clause.Column{Name: o.column}, Value: values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	return clause.Or(or...), nil
+}
+
+// primaryKey matches id against the primary key as a bound value. GORM inlines
+// string ids passed straight to First and Delete as SQL.
+func primaryKey(id any) clause.Expression {
+	return clause.Eq{Column: clause.PrimaryColumn, Value: id}
+}
+
+func hasDeletedAt(s *schema.Schema) bool {
+	for _, field := range s.Fields {
+		if field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func affected(db *gorm.DB) error {
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest/repository"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type user struct {
+	ID        uint
+	Name      string
+	Status    string
+	DeletedAt gorm.DeletedAt
+}
+
+type tag struct {
+	ID   uint
+	Name string
+}
+
+var userColumns = map[string]string{"id": "id", "name": "name", "status": "status"}
+
+func userRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "status", "deleted_at"})
+}
+
+func TestRepositoryGet(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](nil)
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`).
+		WithArgs(1, 1).
+		WillReturnRows(userRows().AddRow(1, "alice", "active", nil))
+	u, err := users.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", u.Name)
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`).
+		WithArgs(2, 1).
+		WillReturnRows(userRows())
+	_, err = users.Get(ctx, 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryStringID(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](nil)
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT $2`).
+		WithArgs("1 OR 1=1", 1).
+		WillReturnRows(userRows())
+	_, err := users.Get(ctx, "1 OR 1=1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = $1`).
+		WithArgs("1 OR 1=1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.ErrorIs(t, users.Delete(ctx, "1 OR 1=1"), gorm.ErrRecordNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "deleted_at"=$1 WHERE "users"."id" = $2 AND "users"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), "1 OR 1=1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.ErrorIs(t, users.SoftDelete(ctx, "1 OR 1=1"), gorm.ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryCreateAndUpdate(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users" ("name","status","deleted_at") VALUES ($1,$2,$3) RETURNING "id"`).
+		WithArgs("alice", "active", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+	u := &user{Name: "alice", Status: "active"}
+	assert.NoError(t, users.Create(ctx, u))
+	assert.Equal(t, uint(7), u.ID)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "name"=$1,"status"=$2,"deleted_at"=$3 WHERE "users"."deleted_at" IS NULL AND "id" = $4`).
+		WithArgs("alice", "inactive", nil, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	u.Status = "inactive"
+	assert.NoError(t, users.Update(ctx, u))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "deleted_at"=$1 WHERE "users"."id" = $2 AND "users"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, users.SoftDelete(ctx, 1))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = $1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, users.Delete(ctx, 1))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "users" WHERE "users"."id" = $1`).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.ErrorIs(t, users.Delete(ctx, 2), gorm.ErrRecordNotFound)
+
+	assert.ErrorIs(t, New[tag](nil).SoftDelete(ctx, 1), ErrNoSoftDelete)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryListOffset(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](&Options{Columns: userColumns})
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE ("status" = $1 AND "name" IN ($2,$3)) AND "users"."deleted_at" IS NULL ORDER BY "name" DESC,"id" LIMIT $4 OFFSET $5`).
+		WithArgs("active", "alice", "bob", 3, 2).
+		WillReturnRows(userRows().AddRow(2, "bob", "active", nil).AddRow(1, "alice", "active", nil))
+
+	page, err := users.List(ctx, &Query{
+		Filters: []Filter{{Field: "status", Operator: Equal, Value: "active"}, {Field: "name", Operator: In, Value: "alice,bob"}},
+		Sort:    []Sort{{Field: "name", Desc: true}},
+		Limit:   2,
+		Offset:  2,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.False(t, page.HasMore)
+	assert.Equal(t, "", page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryListCursor(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](&Options{Columns: userColumns, DefaultSort: []Sort{{Field: "name"}}})
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL ORDER BY "name","id" LIMIT $1`).
+		WithArgs(2).
+		WillReturnRows(userRows().AddRow(1, "alice", "active", nil).AddRow(2, "bob", "active", nil))
+	page, err := users.List(ctx, &Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.True(t, page.HasMore)
+	assert.NotEmpty(t, page.NextCursor)
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE ("name" > $1 OR ("name" = $2 AND "id" > $3)) AND "users"."deleted_at" IS NULL ORDER BY "name","id" LIMIT $4`).
+		WithArgs("alice", "alice", 1, 2).
+		WillReturnRows(userRows().AddRow(2, "bob", "active", nil))
+	cursor := page.NextCursor
+	page, err = users.List(ctx, &Query{Limit: 1, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", page.Items[0].Name)
+	assert.False(t, page.HasMore)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = users.List(ctx, &Query{Limit: 1, Sort: []Sort{{Field: "name", Desc: true}}, Cursor: cursor})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	assert.ErrorContains(t, err, "another sort")
+	_, err = users.List(ctx, &Query{Limit: 1, Sort: []Sort{{Field: "status"}}, Cursor: cursor})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryListErrors(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](&Options{Columns: userColumns})
+
+	for _, query := range []*Query{
+		{Filters: []Filter{{Field: "password", Value: "x"}}},
+		{Sort: []Sort{{Field: "password"}}},
+		{Cursor: "not a cursor"},
+		{Cursor: "WyJhIl0", Offset: 1},
+	} {
+		_, err := users.List(ctx, query)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryListLimit(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	users := New[user](&Options{Columns: userColumns, MaxLimit: 5})
+
+	mock.ExpectQuery(`SELECT * FROM "users" WHERE "users"."deleted_at" IS NULL ORDER BY "id" LIMIT $1`).
+		WithArgs(6).
+		WillReturnRows(userRows())
+	page, err := users.List(ctx, &Query{Limit: 50})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, page.Limit)
+	assert.Empty(t, page.Items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
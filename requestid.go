@@ -0,0 +1,37 @@
+package bucharest
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+const RequestIDKey = "bucharest.requestID"
+
+// AssignRequestID is a middleware that keeps the X-Request-ID header of the
+// request, or generates one, and echoes it on the response.
+func AssignRequestID(ctx HTTPContext) HTTPError {
+	id := ctx.GetHeader(RequestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	}
+	ctx.Set(RequestIDKey, id)
+	ctx.Header(RequestIDHeader, id)
+	ctx.Next()
+	return nil
+}
+
+// RequestID returns the ID set by AssignRequestID, or a RequestIDKey value set
+// with SetValue.
+func RequestID(ctx context.Context) string {
+	if getter, ok := ctx.(interface{ Get(string) (any, bool) }); ok {
+		if id, ok := getter.Get(RequestIDKey); ok {
+			if id, ok := id.(string); ok {
+				return id
+			}
+		}
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
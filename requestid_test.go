@@ -0,0 +1,51 @@
+package bucharest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/argonlab-io/bucharest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveRequestID(header string) (string, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	ctx := NewContextWithOptions(nil)
+	g := gin.New()
+	g.Use(NewGinHandlerFunc(ctx, AssignRequestID))
+
+	var seen string
+	g.GET("/", NewGinHandlerFunc(ctx, func(ctx HTTPContext) HTTPError {
+		seen = RequestID(ctx)
+		return nil
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set(RequestIDHeader, header)
+	}
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	return seen, res
+}
+
+func TestAssignRequestID(t *testing.T) {
+	seen, res := serveRequestID("request-1")
+	assert.Equal(t, "request-1", seen)
+	assert.Equal(t, "request-1", res.Header().Get(RequestIDHeader))
+
+	seen, res = serveRequestID("")
+	assert.NotEmpty(t, seen)
+	assert.Equal(t, seen, res.Header().Get(RequestIDHeader))
+}
+
+func TestRequestID(t *testing.T) {
+	ctx := NewContextWithOptions(nil)
+	assert.Equal(t, "", RequestID(ctx))
+	ctx.SetValue(RequestIDKey, "request-1")
+	assert.Equal(t, "request-1", RequestID(ctx))
+	assert.Equal(t, "request-2", RequestID(context.WithValue(context.Background(), RequestIDKey, "request-2")))
+}
@@ -0,0 +1,145 @@
+package bucharest
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+)
+
+const DefaultRetryAttempts = 5
+const DefaultRetryInitialBackoff = 50 * time.Millisecond
+const DefaultRetryMaxBackoff = 2 * time.Second
+
+type RetryOptions struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable decides which errors are retried, IsTransient by default.
+	Retryable func(err error) bool
+}
+
+// serialization_failure, deadlock_detected and the connection and shutdown
+// classes that show up during a failover.
+var transientSQLStates = []string{"40001", "40P01", "57P01", "57P02", "57P03", "08000", "08003", "08006"}
+
+// ER_LOCK_DEADLOCK and ER_LOCK_WAIT_TIMEOUT.
+var transientMySQLErrors = []uint16{1213, 1205}
+
+var transientRedisPrefixes = []string{"LOADING", "MOVED", "ASK", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "READONLY"}
+
+func (options *RetryOptions) withDefaults() *RetryOptions {
+	o := &RetryOptions{}
+	if options != nil {
+		*o = *options
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = DefaultRetryAttempts
+	}
+	if o.InitialBackoff == 0 {
+		o.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if o.Retryable == nil {
+		o.Retryable = IsTransient
+	}
+	return o
+}
+
+// Retry calls fn until it succeeds, returns an error that is not retryable or
+// runs out of attempts, waiting with exponential backoff and full jitter in
+// between. It gives up early when ctx is done or its deadline would pass before
+// the next attempt. Inside a transaction fn runs only once, since a deadlock or
+// serialization failure aborts the whole transaction and has to be retried
+// from WithTx.
+func Retry(ctx context.Context, options *RetryOptions, fn func() error) error {
+	_, err := RetryResult(ctx, options, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+func RetryResult[T any](ctx context.Context, options *RetryOptions, fn func() (T, error)) (T, error) {
+	options = options.withDefaults()
+	maxAttempts := options.MaxAttempts
+	if c, ok := ctx.(Context); ok && InTx(c) {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= maxAttempts || !options.Retryable(err) {
+			return result, err
+		}
+
+		delay := options.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return result, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (options *RetryOptions) backoff(attempt int) time.Duration {
+	ceiling := options.InitialBackoff
+	for i := 1; i < attempt && ceiling < options.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, options.MaxBackoff)
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// IsTransient reports whether err is a broken connection, a deadlock, a
+// serialization failure or a Redis error that goes away after a failover or
+// cluster resharding.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		for _, state := range transientSQLStates {
+			if sqlState.SQLState() == state {
+				return true
+			}
+		}
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		for _, number := range transientMySQLErrors {
+			if mysqlErr.Number == number {
+				return true
+			}
+		}
+		return false
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range transientRedisPrefixes {
+			if strings.HasPrefix(redisErr.Error(), prefix+" ") || redisErr.Error() == prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package bucharest_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+var fastRetry = &RetryOptions{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func redisError(t *testing.T, message string) error {
+	mr := miniredis.RunT(t)
+	mr.SetError(message)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	return client.Get(context.Background(), "key").Err()
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(fmt.Errorf("query: %w", driver.ErrBadConn)))
+	assert.True(t, IsTransient(mysql.ErrInvalidConn))
+	assert.True(t, IsTransient(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, IsTransient(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, IsTransient(&pgconn.PgError{Code: "23505"}))
+	assert.True(t, IsTransient(&mysql.MySQLError{Number: 1213}))
+	assert.True(t, IsTransient(&mysql.MySQLError{Number: 1205}))
+	assert.False(t, IsTransient(&mysql.MySQLError{Number: 1062}))
+	assert.True(t, IsTransient(redisError(t, "LOADING Redis is loading the dataset in memory")))
+	assert.True(t, IsTransient(redisError(t, "MOVED 3999 127.0.0.1:6381")))
+	assert.False(t, IsTransient(redisError(t, "WRONGTYPE Operation against a key holding the wrong kind of value")))
+	assert.False(t, IsTransient(redis.Nil))
+	assert.False(t, IsTransient(context.DeadlineExceeded))
+	assert.False(t, IsTransient(errors.New("boom")))
+	assert.False(t, IsTransient(nil))
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), fastRetry, func() error {
+		attempts++
+		if attempts < 3 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryStops(t *testing.T) {
+	attempts := 0
+	permanent := errors.New("boom")
+	assert.ErrorIs(t, Retry(context.Background(), fastRetry, func() error {
+		attempts++
+		return permanent
+	}), permanent)
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	assert.ErrorIs(t, Retry(context.Background(), fastRetry, func() error {
+		attempts++
+		return driver.ErrBadConn
+	}), driver.ErrBadConn)
+	assert.Equal(t, DefaultRetryAttempts, attempts)
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	err := Retry(ctx, &RetryOptions{InitialBackoff: time.Hour, MaxBackoff: time.Hour, MaxAttempts: 100}, func() error {
+		attempts++
+		return driver.ErrBadConn
+	})
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.GreaterOrEqual(t, attempts, 1)
+}
+
+func TestRetryResult(t *testing.T) {
+	attempts := 0
+	value, err := RetryResult(context.Background(), fastRetry, func() (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", &pgconn.PgError{Code: "40001"}
+		}
+		return "ok", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", value)
+}
+
+func TestRetryInsideTransaction(t *testing.T) {
+	ctx, mock := newMockContext(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	attempts := 0
+	err := WithTx(ctx, func(txCtx Context) error {
+		return Retry(txCtx, fastRetry, func() error {
+			attempts++
+			return driver.ErrBadConn
+		})
+	})
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 1, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetryWithTx(t *testing.T) {
+	ctx, mock := newMockContext(t)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	attempts := 0
+	err := Retry(ctx, fastRetry, func() error {
+		return WithTx(ctx, func(txCtx Context) error {
+			attempts++
+			if attempts == 1 {
+				return &pgconn.PgError{Code: "40P01"}
+			}
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
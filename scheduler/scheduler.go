@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+	"github.com/go-redis/redis/v8"
+	"github.com/robfig/cron/v3"
+)
+
+const DefaultLockTTL = time.Minute
+const LockPrefix = "scheduler:"
+
+var ErrDuplicateTask = errors.New("a task with this name is already scheduled")
+var ErrInvalidInterval = errors.New("the interval of a task must be above zero")
+
+type Options struct {
+	// Location is the time zone of cron expressions, time.Local by default.
+	Location *time.Location
+	// OnError is called with the errors of the runs, which otherwise go to the
+	// log of the scheduler's context with the task name.
+	OnError func(task string, err error)
+}
+
+type TaskOptions struct {
+	// Distributed runs the task on one replica per tick. The replicas agree on
+	// the ticks through Redis, so their clocks should be in sync.
+	Distributed bool
+	LockTTL     time.Duration
+	Timeout     time.Duration
+}
+
+// Status is what the scheduler knows about a task. Skipped counts the ticks
+// that came while the previous run was still going.
+type Status struct {
+	Name      string
+	Running   bool
+	LastRun   time.Time
+	LastError error
+	NextRun   time.Time
+	Runs      int
+	Skipped   int
+}
+
+type Scheduler struct {
+	options *Options
+	mu      sync.Mutex
+	tasks   []*task
+}
+
+type task struct {
+	name     string
+	schedule cron.Schedule
+	run      func(ctx bucharest.Context) error
+	options  *TaskOptions
+	status   Status
+}
+
+// every fires on multiples of interval, rather than interval after the start,
+// so that replicas started at different times agree on the ticks.
+type every struct {
+	interval time.Duration
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Truncate(e.interval).Add(e.interval)
+}
+
+func New(options *Options) *Scheduler {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.Location == nil {
+		o.Location = time.Local
+	}
+	return &Scheduler{options: o}
+}
+
+// Cron schedules fn on a standard five field cron expression or a descriptor
+// such as @hourly.
+func (s *Scheduler) Cron(name, spec string, fn func(ctx bucharest.Context) error, options *TaskOptions) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return err
+	}
+	return s.add(name, schedule, fn, options)
+}
+
+func (s *Scheduler) Every(name string, interval time.Duration, fn func(ctx bucharest.Context) error, options *TaskOptions) error {
+	if interval <= 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidInterval, interval)
+	}
+	return s.add(name, every{interval: interval}, fn, options)
+}
+
+func (s *Scheduler) add(name string, schedule cron.Schedule, fn func(ctx bucharest.Context) error, options *TaskOptions) error {
+	o := &TaskOptions{}
+	if options != nil {
+		*o = *options
+	}
+	if o.LockTTL == 0 {
+		o.LockTTL = DefaultLockTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateTask, name)
+		}
+	}
+	s.tasks = append(s.tasks, &task{name: name, schedule: schedule, run: fn, options: o, status: Status{Name: name}})
+	return nil
+}
+
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.tasks))
+	for i, t := range s.tasks {
+		statuses[i] = t.status
+	}
+	return statuses
+}
+
+// Run fires the tasks until ctx is done, then waits for the runs in progress.
+// A run is skipped while the previous run of its task is still going. Runs get
+// a Context with the dependencies of ctx that is cancelled with it.
+func (s *Scheduler) Run(ctx bucharest.Context) error {
+	s.mu.Lock()
+	tasks := append([]*task(nil), s.tasks...)
+	s.mu.Unlock()
+
+	var loops, runs sync.WaitGroup
+	for _, t := range tasks {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			s.loop(ctx, t, &runs)
+		}()
+	}
+	loops.Wait()
+	runs.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx bucharest.Context, t *task, runs *sync.WaitGroup) {
+	for {
+		next := t.schedule.Next(time.Now().In(s.options.Location))
+		s.mu.Lock()
+		t.status.NextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		if t.status.Running {
+			t.status.Skipped++
+			s.mu.Unlock()
+			continue
+		}
+		t.status.Running = true
+		s.mu.Unlock()
+
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			ran, err := s.fire(ctx, t, next)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			t.status.Running = false
+			if ran {
+				t.status.Runs++
+				t.status.LastRun = next
+				t.status.LastError = err
+			}
+			if err != nil {
+				s.onError(ctx, t.name, err)
+			}
+		}()
+	}
+}
+
+func (s *Scheduler) onError(ctx bucharest.Context, task string, err error) {
+	if s.options.OnError != nil {
+		s.options.OnError(task, err)
+		return
+	}
+	bucharest.Logger(ctx).WithError(err).WithField("task", task).Error("scheduled task failed")
+}
+
+// fire runs t for the tick at, unless it is distributed and another replica
+// has already taken the tick.
+func (s *Scheduler) fire(ctx bucharest.Context, t *task, at time.Time) (bool, error) {
+	if !t.options.Distributed {
+		return true, s.call(ctx, t)
+	}
+
+	lock, err := bucharest.Lock(ctx, LockPrefix+t.name, t.options.LockTTL)
+	if errors.Is(err, bucharest.ErrLockHeld) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock(context.WithoutCancel(ctx))
+
+	// The lock keeps two replicas from running at once, the last tick keeps a
+	// replica whose timer fired late from running a tick again.
+	client := ctx.UniversalRedis()
+	key := bucharest.LockKeyPrefix + LockPrefix + t.name + ":last"
+	tick := at.UnixMilli()
+	last, err := client.Get(ctx, key).Int64()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+	if last >= tick {
+		return false, nil
+	}
+	if err := client.Set(ctx, key, strconv.FormatInt(tick, 10), 0).Err(); err != nil {
+		return false, err
+	}
+	return true, s.call(ctx, t)
+}
+
+func (s *Scheduler) call(ctx bucharest.Context, t *task) (err error) {
+	runCtx := context.Context(ctx)
+	if t.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, t.options.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return t.run(bucharest.WithParent(ctx, runCtx))
+}
@@ -0,0 +1,152 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/scheduler"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func runFor(t *testing.T, ctx bucharest.Context, d time.Duration, schedulers ...*Scheduler) {
+	parent, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	runCtx := bucharest.WithParent(ctx, parent)
+	done := make(chan struct{}, len(schedulers))
+	for _, s := range schedulers {
+		go func() {
+			assert.NoError(t, s.Run(runCtx))
+			done <- struct{}{}
+		}()
+	}
+	for range schedulers {
+		<-done
+	}
+}
+
+func TestEvery(t *testing.T) {
+	s := New(nil)
+	var runs int32
+	failure := errors.New("failed")
+	assert.NoError(t, s.Every("tick", 20*time.Millisecond, func(ctx bucharest.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return failure
+		}
+		return nil
+	}, nil))
+
+	logger, hook := test.NewNullLogger()
+	runFor(t, bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger}), 110*time.Millisecond, s)
+	n := atomic.LoadInt32(&runs)
+	assert.GreaterOrEqual(t, n, int32(4))
+	assert.LessOrEqual(t, n, int32(6))
+
+	status := s.Status()[0]
+	assert.Equal(t, "tick", status.Name)
+	assert.Equal(t, int(n), status.Runs)
+	assert.NoError(t, status.LastError)
+	assert.False(t, status.LastRun.IsZero())
+	assert.True(t, status.NextRun.After(status.LastRun))
+	assert.Zero(t, status.NextRun.UnixNano()%int64(20*time.Millisecond))
+
+	assert.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, "scheduled task failed", hook.LastEntry().Message)
+	assert.Equal(t, "tick", hook.LastEntry().Data["task"])
+}
+
+func TestEveryInvalidInterval(t *testing.T) {
+	s := New(nil)
+	noop := func(bucharest.Context) error { return nil }
+	assert.ErrorIs(t, s.Every("zero", 0, noop, nil), ErrInvalidInterval)
+	assert.ErrorIs(t, s.Every("negative", -time.Second, noop, nil), ErrInvalidInterval)
+	assert.Empty(t, s.Status())
+}
+
+func TestNoOverlap(t *testing.T) {
+	var reported []error
+	s := New(&Options{OnError: func(task string, err error) { reported = append(reported, err) }})
+	var running, overlapped int32
+	assert.NoError(t, s.Every("slow", 10*time.Millisecond, func(ctx bucharest.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		time.Sleep(35 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		panic("boom")
+	}, nil))
+
+	runFor(t, bucharest.NewContextWithOptions(nil), 100*time.Millisecond, s)
+	assert.Zero(t, atomic.LoadInt32(&overlapped))
+	status := s.Status()[0]
+	assert.Greater(t, status.Skipped, 0)
+	assert.EqualError(t, status.LastError, "task panicked: boom")
+	assert.Len(t, reported, status.Runs)
+}
+
+func TestCron(t *testing.T) {
+	s := New(&Options{Location: time.UTC})
+	assert.Error(t, s.Cron("bad", "* * *", func(bucharest.Context) error { return nil }, nil))
+	assert.NoError(t, s.Cron("hourly", "@hourly", func(bucharest.Context) error { return nil }, nil))
+	assert.ErrorIs(t, s.Cron("hourly", "0 * * * *", func(bucharest.Context) error { return nil }, nil), ErrDuplicateTask)
+
+	runFor(t, bucharest.NewContextWithOptions(nil), 10*time.Millisecond, s)
+	next := s.Status()[0].NextRun
+	assert.Equal(t, time.Now().UTC().Truncate(time.Hour).Add(time.Hour), next)
+	assert.Zero(t, s.Status()[0].Runs)
+}
+
+func TestShutdownWaitsForRuns(t *testing.T) {
+	s := New(nil)
+	var finished int32
+	assert.NoError(t, s.Every("job", 10*time.Millisecond, func(ctx bucharest.Context) error {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	}, &TaskOptions{Timeout: time.Hour}))
+
+	runFor(t, bucharest.NewContextWithOptions(nil), 30*time.Millisecond, s)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
+
+func TestDistributed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	newContext := func() bucharest.Context {
+		return bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	}
+
+	var runs int32
+	task := func(bucharest.Context) error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+	a, b := New(nil), New(nil)
+	assert.NoError(t, a.Every("report", 50*time.Millisecond, task, &TaskOptions{Distributed: true}))
+	assert.NoError(t, b.Every("report", 50*time.Millisecond, task, &TaskOptions{Distributed: true}))
+
+	ctx := newContext()
+	parent, cancel := context.WithTimeout(ctx, 260*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		a.Run(bucharest.WithParent(ctx, parent))
+		close(done)
+	}()
+	other := newContext()
+	b.Run(bucharest.WithParent(other, parent))
+	<-done
+
+	n := atomic.LoadInt32(&runs)
+	assert.GreaterOrEqual(t, n, int32(4))
+	assert.LessOrEqual(t, n, int32(6))
+	assert.Equal(t, int(n), a.Status()[0].Runs+b.Status()[0].Runs)
+	assert.True(t, mr.Exists(bucharest.LockKeyPrefix+LockPrefix+"report:last"))
+}
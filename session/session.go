@@ -0,0 +1,286 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/argonlab-io/bucharest"
+)
+
+const DefaultCookieName = "bucharest_session"
+const DefaultPrefix = "session:"
+const DefaultIdleTimeout = 30 * time.Minute
+const DefaultAbsoluteTimeout = 24 * time.Hour
+
+const Key = "bucharest.session"
+
+var ErrNoSession = errors.New("the session middleware is not present in this context")
+
+type Options struct {
+	// Store defaults to Redis when the context has a client and to a MemoryStore
+	// otherwise.
+	Store      Store
+	CookieName string
+	Path       string
+	Domain     string
+	// Insecure lets the cookie be sent over plain HTTP, for local development.
+	Insecure bool
+	SameSite http.SameSite
+	// A session ends after IdleTimeout without a request, or AbsoluteTimeout
+	// after it was started or last rotated, whichever comes first.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+	// OnError is called when the session cannot be saved after the handlers
+	// ran. The request's logger reports the error when OnError is nil.
+	OnError func(err error)
+}
+
+type record struct {
+	Values    map[string]json.RawMessage   `json:"values,omitempty"`
+	Flashes   map[string][]json.RawMessage `json:"flashes,omitempty"`
+	CreatedAt time.Time                    `json:"created_at"`
+	LastSeen  time.Time                    `json:"last_seen"`
+}
+
+// State is the session of one request. It is started by the first write, so
+// requests that never write one do not get a cookie.
+type State struct {
+	ctx     bucharest.HTTPContext
+	options *Options
+	store   Store
+	id      string
+	record  record
+	// stale holds the IDs that were rotated away or destroyed.
+	stale []string
+}
+
+func Middleware(options *Options) bucharest.HandlerFunc {
+	o := &Options{}
+	if options != nil {
+		*o = *options
+	}
+	if o.CookieName == "" {
+		o.CookieName = DefaultCookieName
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = DefaultIdleTimeout
+	}
+	if o.AbsoluteTimeout == 0 {
+		o.AbsoluteTimeout = DefaultAbsoluteTimeout
+	}
+	memory := NewMemoryStore()
+
+	return func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		store := o.Store
+		if store == nil {
+			store = memory
+			if bucharest.HasRedis(ctx) {
+				store = NewRedisStore(ctx.UniversalRedis())
+			}
+		}
+
+		s := &State{ctx: ctx, options: o, store: store}
+		if err := s.load(); err != nil {
+			return bucharest.NewInternalServerError(err)
+		}
+		ctx.Set(Key, s)
+		ctx.Next()
+		s.save()
+		return nil
+	}
+}
+
+// Session returns the session of the request, and panics with ErrNoSession
+// when Middleware did not run for it.
+func Session(ctx bucharest.HTTPContext) *State {
+	s, ok := ctx.Get(Key)
+	if !ok {
+		panic(ErrNoSession)
+	}
+	return s.(*State)
+}
+
+// Get decodes the value stored under key. It reports false when there is none
+// or it does not decode into T.
+func Get[T any](s *State, key string) (T, bool) {
+	var value T
+	raw, ok := s.record.Values[key]
+	if !ok {
+		return value, false
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, false
+	}
+	return value, true
+}
+
+// Flashes returns the flash messages added under key and removes them.
+func Flashes[T any](s *State, key string) []T {
+	raws := s.record.Flashes[key]
+	if len(raws) == 0 {
+		return nil
+	}
+	delete(s.record.Flashes, key)
+
+	flashes := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var flash T
+		if err := json.Unmarshal(raw, &flash); err == nil {
+			flashes = append(flashes, flash)
+		}
+	}
+	return flashes
+}
+
+// ID is empty until the session is started.
+func (s *State) ID() string {
+	return s.id
+}
+
+func (s *State) Set(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.start()
+	if s.record.Values == nil {
+		s.record.Values = make(map[string]json.RawMessage)
+	}
+	s.record.Values[key] = raw
+	return nil
+}
+
+func (s *State) Delete(key string) {
+	delete(s.record.Values, key)
+}
+
+// Flash adds a message under key that is kept until Flashes reads it, usually
+// on the request after a redirect.
+func (s *State) Flash(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.start()
+	if s.record.Flashes == nil {
+		s.record.Flashes = make(map[string][]json.RawMessage)
+	}
+	s.record.Flashes[key] = append(s.record.Flashes[key], raw)
+	return nil
+}
+
+// Rotate moves the session to a new ID and restarts its absolute timeout. Call
+// it when the user logs in or their privileges change, so that an ID planted
+// before then is worthless.
+func (s *State) Rotate() {
+	if s.id == "" {
+		s.start()
+		return
+	}
+	s.stale = append(s.stale, s.id)
+	s.id = newID()
+	s.record.CreatedAt = time.Now()
+	s.setCookie(s.id, int(s.options.AbsoluteTimeout.Seconds()))
+}
+
+// Destroy ends the session and expires its cookie.
+func (s *State) Destroy() {
+	if s.id == "" {
+		return
+	}
+	s.stale = append(s.stale, s.id)
+	s.id = ""
+	s.record = record{}
+	s.setCookie("", -1)
+}
+
+func (s *State) start() {
+	if s.id != "" {
+		return
+	}
+	now := time.Now()
+	s.id = newID()
+	s.record = record{CreatedAt: now, LastSeen: now}
+	s.setCookie(s.id, int(s.options.AbsoluteTimeout.Seconds()))
+}
+
+func (s *State) setCookie(value string, maxAge int) {
+	s.ctx.SetSameSite(s.options.SameSite)
+	s.ctx.SetCookie(s.options.CookieName, value, maxAge, s.options.Path, s.options.Domain, !s.options.Insecure, true)
+}
+
+func (s *State) load() error {
+	id, err := s.ctx.Cookie(s.options.CookieName)
+	if err != nil || id == "" {
+		return nil
+	}
+	data, ok, err := s.store.Load(s.ctx, id)
+	if err != nil || !ok {
+		return err
+	}
+
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		s.stale = append(s.stale, id)
+		return nil
+	}
+	now := time.Now()
+	if now.Sub(r.LastSeen) > s.options.IdleTimeout || now.Sub(r.CreatedAt) > s.options.AbsoluteTimeout {
+		s.stale = append(s.stale, id)
+		return nil
+	}
+	s.id = id
+	s.record = r
+	return nil
+}
+
+// save runs after the handlers, so it cannot fail the response any more. Every
+// request saves the session to push back its idle timeout.
+func (s *State) save() {
+	ctx := context.WithoutCancel(s.ctx)
+	for _, id := range s.stale {
+		if err := s.store.Delete(ctx, id); err != nil {
+			s.onError(err)
+		}
+	}
+	if s.id == "" {
+		return
+	}
+
+	now := time.Now()
+	s.record.LastSeen = now
+	ttl := min(s.options.IdleTimeout, s.record.CreatedAt.Add(s.options.AbsoluteTimeout).Sub(now))
+	data, err := json.Marshal(s.record)
+	if err != nil {
+		s.onError(err)
+		return
+	}
+	if err := s.store.Save(ctx, s.id, data, ttl); err != nil {
+		s.onError(err)
+	}
+}
+
+func (s *State) onError(err error) {
+	if s.options.OnError != nil {
+		s.options.OnError(err)
+		return
+	}
+	bucharest.Logger(s.ctx).WithError(err).Error("session could not be saved")
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
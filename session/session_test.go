@@ -0,0 +1,221 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/session"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type profile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newRouter(ctx bucharest.Context, options *Options, handler bucharest.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.GET("/", bucharest.NewGinHandlerFunc(ctx, Middleware(options)), bucharest.NewGinHandlerFunc(ctx, handler))
+	return g
+}
+
+func serve(g *gin.Engine, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	return res
+}
+
+func sessionCookie(res *httptest.ResponseRecorder) *http.Cookie {
+	var found *http.Cookie
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == DefaultCookieName {
+			found = cookie
+		}
+	}
+	return found
+}
+
+func TestSession(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+
+	var seen profile
+	var found bool
+	g := newRouter(ctx, nil, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		s := Session(ctx)
+		seen, found = Get[profile](s, "profile")
+		if !found {
+			assert.NoError(t, s.Set("profile", profile{ID: 1, Name: "alice"}))
+		}
+		return nil
+	})
+
+	res := serve(g, nil)
+	cookie := sessionCookie(res)
+	assert.NotNil(t, cookie)
+	assert.False(t, found)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, int(DefaultAbsoluteTimeout.Seconds()), cookie.MaxAge)
+	assert.True(t, mr.Exists(DefaultPrefix+cookie.Value))
+	assert.Equal(t, DefaultIdleTimeout, mr.TTL(DefaultPrefix+cookie.Value))
+
+	res = serve(g, cookie)
+	assert.True(t, found)
+	assert.Equal(t, profile{ID: 1, Name: "alice"}, seen)
+	assert.Nil(t, sessionCookie(res))
+}
+
+func TestSessionNotStartedWithoutWrite(t *testing.T) {
+	store := NewMemoryStore()
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Store: store}, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		_, ok := Get[string](Session(ctx), "missing")
+		assert.False(t, ok)
+		assert.Empty(t, Session(ctx).ID())
+		return nil
+	})
+
+	assert.Nil(t, sessionCookie(serve(g, nil)))
+}
+
+func TestSessionRotate(t *testing.T) {
+	store := NewMemoryStore()
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Store: store}, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		s := Session(ctx)
+		if ctx.Query("login") != "" {
+			s.Rotate()
+		}
+		assert.NoError(t, s.Set("user", 42))
+		return nil
+	})
+
+	first := sessionCookie(serve(g, nil))
+	req := httptest.NewRequest(http.MethodGet, "/?login=1", nil)
+	req.AddCookie(first)
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	second := sessionCookie(res)
+
+	assert.NotEqual(t, first.Value, second.Value)
+	_, ok, _ := store.Load(req.Context(), first.Value)
+	assert.False(t, ok)
+	_, ok, _ = store.Load(req.Context(), second.Value)
+	assert.True(t, ok)
+}
+
+func TestSessionDestroy(t *testing.T) {
+	store := NewMemoryStore()
+	g := newRouter(bucharest.NewContextWithOptions(nil), &Options{Store: store}, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		s := Session(ctx)
+		if s.ID() == "" {
+			assert.NoError(t, s.Set("user", 42))
+		} else {
+			s.Destroy()
+		}
+		return nil
+	})
+
+	cookie := sessionCookie(serve(g, nil))
+	expired := sessionCookie(serve(g, cookie))
+	assert.Equal(t, -1, expired.MaxAge)
+	_, ok, _ := store.Load(httptest.NewRequest(http.MethodGet, "/", nil).Context(), cookie.Value)
+	assert.False(t, ok)
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	for _, options := range []*Options{
+		{IdleTimeout: 20 * time.Millisecond},
+		{AbsoluteTimeout: 20 * time.Millisecond},
+	} {
+		options.Store = NewMemoryStore()
+		options.Insecure = true
+		var found bool
+		g := newRouter(bucharest.NewContextWithOptions(nil), options, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+			s := Session(ctx)
+			_, found = Get[int](s, "user")
+			assert.NoError(t, s.Set("user", 42))
+			return nil
+		})
+
+		cookie := sessionCookie(serve(g, nil))
+		assert.False(t, cookie.Secure)
+		serve(g, cookie)
+		assert.True(t, found)
+
+		time.Sleep(30 * time.Millisecond)
+		serve(g, cookie)
+		assert.False(t, found)
+	}
+}
+
+func TestFlashes(t *testing.T) {
+	var flashes []string
+	g := newRouter(bucharest.NewContextWithOptions(nil), nil, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		s := Session(ctx)
+		if ctx.Query("save") != "" {
+			assert.NoError(t, s.Flash("notice", "saved"))
+			assert.NoError(t, s.Flash("notice", "emailed"))
+			return nil
+		}
+		flashes = Flashes[string](s, "notice")
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/?save=1", nil)
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	cookie := sessionCookie(res)
+
+	serve(g, cookie)
+	assert.Equal(t, []string{"saved", "emailed"}, flashes)
+	serve(g, cookie)
+	assert.Empty(t, flashes)
+}
+
+func TestSessionWithoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.GET("/", bucharest.NewGinHandlerFunc(bucharest.NewContextWithOptions(nil), func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		utils.AssertPanic(t, func() { Session(ctx) }, ErrNoSession)
+		return nil
+	}))
+	serve(g, nil)
+}
+
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Save(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestSessionSaveErrorLogged(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	ctx := bucharest.NewContextWithOptions(&bucharest.ContextOptions{Logrus: logger})
+	g := newRouter(ctx, &Options{Store: failingStore{NewMemoryStore()}}, func(ctx bucharest.HTTPContext) bucharest.HTTPError {
+		assert.NoError(t, Session(ctx).Set("user", 1))
+		return nil
+	})
+
+	serve(g, nil)
+	assert.Equal(t, "session could not be saved", hook.LastEntry().Message)
+	assert.EqualError(t, hook.LastEntry().Data[logrus.ErrorKey].(error), "connection refused")
+}
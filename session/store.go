@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type Store interface {
+	Load(ctx context.Context, id string) ([]byte, bool, error)
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+type RedisStore struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client, Prefix: DefaultPrefix}
+}
+
+func (s *RedisStore) Load(ctx context.Context, id string) ([]byte, bool, error) {
+	data, err := s.Client.Get(ctx, s.Prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (s *RedisStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return s.Client.Set(ctx, s.Prefix+id, data, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, id string) error {
+	return s.Client.Del(ctx, s.Prefix+id).Err()
+}
+
+const DefaultMaxMemorySessions = 10000
+
+// MemoryStore keeps sessions in process, for tests and single instance apps.
+// Expired sessions are swept every sweepInterval saves, and once MaxSessions
+// is reached the session closest to expiring is evicted.
+type MemoryStore struct {
+	MaxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	saves    int
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+const sweepInterval = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{MaxSessions: DefaultMaxMemorySessions, sessions: make(map[string]memorySession)}
+}
+
+func (s *MemoryStore) Load(_ context.Context, id string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(session.expiresAt) {
+		delete(s.sessions, id)
+		return nil, false, nil
+	}
+	return session.data, true, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saves++; s.saves%sweepInterval == 0 {
+		s.sweep(now)
+	}
+	if _, ok := s.sessions[id]; !ok && s.MaxSessions > 0 && len(s.sessions) >= s.MaxSessions {
+		s.sweep(now)
+		if len(s.sessions) >= s.MaxSessions {
+			s.evict()
+		}
+	}
+	s.sessions[id] = memorySession{data: data, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for id, session := range s.sessions {
+		if now.After(session.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (s *MemoryStore) evict() {
+	var evicted string
+	var expiresAt time.Time
+	for id, session := range s.sessions {
+		if evicted == "" || session.expiresAt.Before(expiresAt) {
+			evicted, expiresAt = id, session.expiresAt
+		}
+	}
+	delete(s.sessions, evicted)
+}
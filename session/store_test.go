@@ -0,0 +1,62 @@
+package session_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest/session"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	for _, store := range []Store{NewMemoryStore(), NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))} {
+		_, ok, err := store.Load(ctx, "id")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.NoError(t, store.Save(ctx, "id", []byte("data"), time.Minute))
+		data, ok, err := store.Load(ctx, "id")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("data"), data)
+
+		assert.NoError(t, store.Delete(ctx, "id"))
+		_, ok, _ = store.Load(ctx, "id")
+		assert.False(t, ok)
+	}
+	assert.False(t, mr.Exists(DefaultPrefix+"id"))
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	assert.NoError(t, store.Save(ctx, "id", []byte("data"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, err := store.Load(ctx, "id")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemoryStoreMaxSessions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.MaxSessions = 2
+
+	assert.NoError(t, store.Save(ctx, "expired", []byte("1"), time.Millisecond))
+	assert.NoError(t, store.Save(ctx, "long", []byte("2"), time.Hour))
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, store.Save(ctx, "short", []byte("3"), time.Minute))
+	assert.NoError(t, store.Save(ctx, "short", []byte("4"), time.Minute))
+	assert.NoError(t, store.Save(ctx, "new", []byte("5"), time.Hour))
+
+	for id, kept := range map[string]bool{"expired": false, "long": true, "short": false, "new": true} {
+		_, ok, err := store.Load(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, kept, ok, id)
+	}
+}
@@ -0,0 +1,20 @@
+// Package sqlite opens sqlite databases with GORM. It is kept out of the root
+// package because gorm.io/driver/sqlite needs cgo, pass Dialector to
+// bucharest.OpenOptions to use it.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/argonlab-io/bucharest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Dialector(driverName string, db *sql.DB) (gorm.Dialector, error) {
+	if driverName != "sqlite3" {
+		return nil, fmt.Errorf("%w: %s", bucharest.ErrUnsupportedDriver, driverName)
+	}
+	return sqlite.New(sqlite.Config{Conn: db}), nil
+}
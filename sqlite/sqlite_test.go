@@ -0,0 +1,47 @@
+package sqlite_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/argonlab-io/bucharest"
+	. "github.com/argonlab-io/bucharest/sqlite"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenFromENV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("DB_DRIVER=sqlite\nDB_NAME="+filepath.Join(dir, "bucharest.db")), 0600))
+	env, err := bucharest.NewENVWithOptions(&bucharest.ENVOptions{Filename: path, Viper: viper.New()})
+	assert.NoError(t, err)
+
+	options, err := bucharest.OpenFromENV(env, &bucharest.OpenOptions{Dialector: Dialector})
+	assert.NoError(t, err)
+	defer options.SQL.Close()
+	assert.Equal(t, "sqlite3", options.SQLX.DriverName())
+	assert.Equal(t, "sqlite", options.GORM.Dialector.Name())
+
+	ctx := bucharest.NewContextWithOptions(options)
+	_, err = ctx.SQL().Exec("CREATE TABLE foo (id INTEGER PRIMARY KEY, bar TEXT)")
+	assert.NoError(t, err)
+	err = bucharest.WithTx(ctx, func(txCtx bucharest.Context) error {
+		if _, err := txCtx.SQLXHandle().ExecContext(txCtx, "INSERT INTO foo (bar) VALUES (?)", "sqlx"); err != nil {
+			return err
+		}
+		return txCtx.GORM().Exec("INSERT INTO foo (bar) VALUES (?)", "gorm").Error
+	})
+	assert.NoError(t, err)
+
+	var bars []string
+	assert.NoError(t, ctx.SQLX().Select(&bars, "SELECT bar FROM foo ORDER BY id"))
+	assert.Equal(t, []string{"sqlx", "gorm"}, bars)
+	assert.Equal(t, "sqlite3", bucharest.DriverName(options.SQL))
+}
+
+func TestDialectorUnsupportedDriver(t *testing.T) {
+	_, err := Dialector("pgx", nil)
+	assert.ErrorIs(t, err, bucharest.ErrUnsupportedDriver)
+}
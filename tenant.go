@@ -0,0 +1,444 @@
+package bucharest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+const TenantKey = "bucharest.tenant"
+
+var ErrNoTenant = errors.New("the request does not name a tenant")
+var ErrUnknownTenant = errors.New("the tenant is not registered")
+var ErrUnsupportedRedisClient = errors.New("cannot prefix the keys of this Redis client")
+var ErrUnscopedRedisCommand = errors.New("the Redis command cannot be scoped to a tenant")
+var ErrUnscopedHandle = errors.New("the handle is not scoped to a tenant, add TenantRegistry.Middleware to the route")
+
+type TenantResolver func(ctx HTTPContext) (string, error)
+
+type TenantOptions struct {
+	// Open is called the first time a tenant is seen and may return
+	// ErrUnknownTenant to reject it. Tenants added with Register never reach it.
+	// The replicas of a tenant are health checked every
+	// ReplicaHealthCheckInterval of its options, as long as the registry lives.
+	Open func(tenant string) (*ContextOptions, error)
+	// RedisKeyPrefix prefixes every key and PUBLISH channel that the tenant's
+	// Redis commands touch, and commands whose keys are unknown fail with
+	// ErrUnscopedRedisCommand. The tenant gets its own *redis.Client,
+	// *redis.ClusterClient or *redis.Ring with the same options as the one it
+	// was registered with. go-redis subscribes without running hooks, so
+	// subscribers of a tenant add the prefix to their channels themselves.
+	RedisKeyPrefix func(tenant string) string
+}
+
+type TenantRegistry struct {
+	options *TenantOptions
+	mu      sync.RWMutex
+	tenants map[string]*tenantEntry
+	opening singleflight.Group
+}
+
+// tenantEntry keeps the replica set of a tenant, so that every request of the
+// tenant shares it and its health check.
+type tenantEntry struct {
+	options  *ContextOptions
+	replicas *replicaSet
+}
+
+func NewTenantRegistry(options *TenantOptions) *TenantRegistry {
+	if options == nil {
+		options = &TenantOptions{}
+	}
+	return &TenantRegistry{options: options, tenants: make(map[string]*tenantEntry)}
+}
+
+func (r *TenantRegistry) Register(tenant string, options *ContextOptions) error {
+	entry, err := r.newEntry(tenant, options)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if previous, ok := r.tenants[tenant]; ok && previous.replicas != nil {
+		previous.replicas.stop()
+	}
+	r.tenants[tenant] = entry
+	return nil
+}
+
+func (r *TenantRegistry) Tenant(tenant string) (*ContextOptions, error) {
+	entry, err := r.entry(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return entry.options, nil
+}
+
+// entry opens an unknown tenant outside of the lock, so that a slow database
+// does not hold up the requests of the other tenants, and only once however
+// many requests ask for it at the same time.
+func (r *TenantRegistry) entry(tenant string) (*tenantEntry, error) {
+	r.mu.RLock()
+	entry, ok := r.tenants[tenant]
+	r.mu.RUnlock()
+	if ok {
+		return entry, nil
+	}
+	if r.options.Open == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, tenant)
+	}
+
+	opened, err, _ := r.opening.Do(tenant, func() (any, error) {
+		r.mu.RLock()
+		entry, ok := r.tenants[tenant]
+		r.mu.RUnlock()
+		if ok {
+			return entry, nil
+		}
+
+		options, err := r.options.Open(tenant)
+		if err != nil {
+			return nil, err
+		}
+		if entry, err = r.newEntry(tenant, options); err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if existing, ok := r.tenants[tenant]; ok {
+			if entry.replicas != nil {
+				entry.replicas.stop()
+			}
+			return existing, nil
+		}
+		r.tenants[tenant] = entry
+		return entry, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return opened.(*tenantEntry), nil
+}
+
+func (r *TenantRegistry) newEntry(tenant string, options *ContextOptions) (*tenantEntry, error) {
+	options, err := r.prefixRedis(tenant, options)
+	if err != nil {
+		return nil, err
+	}
+	entry := &tenantEntry{options: options, replicas: newReplicaSet(options.Replicas, options.ReplicaPolicy)}
+	if entry.replicas != nil && options.ReplicaHealthCheckInterval > 0 {
+		parent := options.Parent
+		if parent == nil {
+			parent = context.Background()
+		}
+		entry.replicas.start(parent, options.ReplicaHealthCheckInterval)
+	}
+	return entry, nil
+}
+
+func (r *TenantRegistry) prefixRedis(tenant string, options *ContextOptions) (*ContextOptions, error) {
+	if r.options.RedisKeyPrefix == nil || options.Redis == nil {
+		return options, nil
+	}
+
+	o := *options
+	switch client := options.Redis.(type) {
+	case *redis.Client:
+		clientOptions := *client.Options()
+		o.Redis = redis.NewClient(&clientOptions)
+	case *redis.ClusterClient:
+		clusterOptions := *client.Options()
+		o.Redis = redis.NewClusterClient(&clusterOptions)
+	case *redis.Ring:
+		ringOptions := *client.Options()
+		o.Redis = redis.NewRing(&ringOptions)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedRedisClient, client)
+	}
+	o.Redis.AddHook(&redisKeyPrefixHook{prefix: r.options.RedisKeyPrefix(tenant)})
+	return &o, nil
+}
+
+// Middleware resolves the tenant of the request and swaps the GORM, SQL, SQLX
+// and Redis handles of the HTTPContext for the tenant's for the rest of the
+// handler chain.
+func (r *TenantRegistry) Middleware(resolve TenantResolver) HandlerFunc {
+	return func(ctx HTTPContext) HTTPError {
+		tenant, err := resolve(ctx)
+		if err == nil && tenant == "" {
+			err = ErrNoTenant
+		}
+		if err != nil {
+			return NewBadRequestError(err)
+		}
+
+		entry, err := r.entry(tenant)
+		if errors.Is(err, ErrUnknownTenant) {
+			return NewBadRequestError(err)
+		}
+		if err != nil {
+			return NewInternalServerError(err)
+		}
+
+		ctx.Set(TenantKey, tenant)
+		defer scopeContext(ctx, baseOf(ctx).forTenant(ctx, tenant, entry))()
+		ctx.Next()
+		return nil
+	}
+}
+
+func Tenant(ctx Context) string {
+	return baseOf(ctx).tenant
+}
+
+func TenantFromHeader(header string) TenantResolver {
+	return func(ctx HTTPContext) (string, error) {
+		return ctx.GetHeader(header), nil
+	}
+}
+
+// TenantFromSubdomain takes the label in front of domain, so
+// TenantFromSubdomain("example.com") resolves acme.example.com to "acme".
+func TenantFromSubdomain(domain string) TenantResolver {
+	return func(ctx HTTPContext) (string, error) {
+		host := ctx.Gin().Request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		tenant, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+		if !ok || strings.Contains(tenant, ".") {
+			return "", ErrNoTenant
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromClaim reads claim from the claims an authentication middleware
+// stored under claimsKey, such as a jwt.MapClaims.
+func TenantFromClaim(claimsKey, claim string) TenantResolver {
+	return func(ctx HTTPContext) (string, error) {
+		claims, ok := ctx.Get(claimsKey)
+		if !ok {
+			return "", ErrNoTenant
+		}
+		v := reflect.ValueOf(claims)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return "", ErrNoTenant
+		}
+		value := v.MapIndex(reflect.ValueOf(claim).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return "", ErrNoTenant
+		}
+		tenant, ok := value.Interface().(string)
+		if !ok {
+			return "", ErrNoTenant
+		}
+		return tenant, nil
+	}
+}
+
+func (ctx *BuchatrestContext) forTenant(parent context.Context, tenant string, entry *tenantEntry) *BuchatrestContext {
+	options := entry.options
+	child := ctx.derive(parent)
+	child.tenant = tenant
+	child.tx = nil
+	child.primary = nil
+	child.gorm_ = options.GORM
+	child.redis_ = options.Redis
+	child.sql_ = options.SQL
+	child.sqlx_ = options.SQLX
+	child.replicas = entry.replicas
+	return child
+}
+
+func (ctx *BuchatrestContext) guardTenant() {
+	if ctx.requireTenant && ctx.tenant == "" {
+		panic(ErrUnscopedHandle)
+	}
+}
+
+func recoverUnscopedHandle(g *gin.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if err, ok := r.(error); ok && errors.Is(err, ErrUnscopedHandle) {
+		httpError := NewInternalServerError(err)
+		g.Set(httpErrorKey, httpError)
+		g.AbortWithStatusJSON(httpError.GetStatus(), httpError.GetJSON())
+		return
+	}
+	panic(r)
+}
+
+type redisKeyPrefixHook struct {
+	prefix string
+}
+
+func (h *redisKeyPrefixHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	keys, err := redisKeys(cmd.Args())
+	if err != nil {
+		return ctx, err
+	}
+	prefixKeys(h.prefix, cmd.Args(), keys)
+	return ctx, nil
+}
+
+func (h *redisKeyPrefixHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *redisKeyPrefixHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	keys := make([][]int, len(cmds))
+	for i, cmd := range cmds {
+		var err error
+		if keys[i], err = redisKeys(cmd.Args()); err != nil {
+			return ctx, err
+		}
+	}
+	for i, cmd := range cmds {
+		prefixKeys(h.prefix, cmd.Args(), keys[i])
+	}
+	return ctx, nil
+}
+
+func (h *redisKeyPrefixHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func prefixKeys(prefix string, args []any, keys []int) {
+	for _, i := range keys {
+		args[i] = prefix + fmt.Sprint(args[i])
+	}
+}
+
+// redisKeys returns the indexes of the key arguments of a command, as COMMAND
+// GETKEYS would. Commands missing from redisKeySpecs are rejected rather than
+// run across tenants.
+func redisKeys(args []any) ([]int, error) {
+	name := strings.ToLower(fmt.Sprint(args[0]))
+	spec, ok := redisKeySpecs[name]
+	if subcommands, found := redisSubcommandKeySpecs[name]; found && len(args) > 1 {
+		name += " " + strings.ToLower(fmt.Sprint(args[1]))
+		spec, ok = subcommands[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnscopedRedisCommand, name)
+	}
+	return spec.keys(name, args)
+}
+
+// redisKeySpec finds the keys from first to last, every step, where a negative
+// last counts from the end. numKeys is the index of the argument that counts
+// the keys right after it, streams takes the first half of the arguments after
+// STREAMS, and match takes the pattern after MATCH.
+type redisKeySpec struct {
+	first, last, step int
+	numKeys           int
+	streams           bool
+	match             bool
+}
+
+func (s redisKeySpec) keys(name string, args []any) ([]int, error) {
+	var keys []int
+	if s.first > 0 {
+		last := s.last
+		if last < 0 {
+			last += len(args)
+		}
+		step := max(s.step, 1)
+		for i := s.first; i <= last && i < len(args); i += step {
+			keys = append(keys, i)
+		}
+	}
+	if s.numKeys > 0 && s.numKeys < len(args) {
+		n, err := strconv.Atoi(fmt.Sprint(args[s.numKeys]))
+		if err != nil || n < 0 || s.numKeys+n >= len(args) {
+			return nil, fmt.Errorf("%w: %s has a malformed key count", ErrUnscopedRedisCommand, name)
+		}
+		for i := s.numKeys + 1; i <= s.numKeys+n; i++ {
+			keys = append(keys, i)
+		}
+	}
+	if s.streams {
+		i := slices.IndexFunc(args, func(arg any) bool { return strings.EqualFold(fmt.Sprint(arg), "streams") })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s has no STREAMS", ErrUnscopedRedisCommand, name)
+		}
+		for j := i + 1; j <= i+(len(args)-i-1)/2; j++ {
+			keys = append(keys, j)
+		}
+	}
+	if s.match {
+		// SCAN would return the keys of every tenant without a pattern.
+		i := slices.IndexFunc(args, func(arg any) bool { return strings.EqualFold(fmt.Sprint(arg), "match") })
+		if i < 2 || i+1 >= len(args) {
+			return nil, fmt.Errorf("%w: %s needs a MATCH pattern", ErrUnscopedRedisCommand, name)
+		}
+		keys = append(keys, i+1)
+	}
+	return keys, nil
+}
+
+var (
+	noKeys        = redisKeySpec{}
+	firstKey      = redisKeySpec{first: 1, last: 1}
+	twoKeys       = redisKeySpec{first: 1, last: 2}
+	allKeys       = redisKeySpec{first: 1, last: -1}
+	blockingKeys  = redisKeySpec{first: 1, last: -2}
+	subcommandKey = redisKeySpec{first: 2, last: 2}
+)
+
+var redisSubcommandKeySpecs = map[string]map[string]redisKeySpec{
+	"memory": {"memory usage": subcommandKey, "memory stats": noKeys, "memory doctor": noKeys, "memory help": noKeys},
+	"object": {"object encoding": subcommandKey, "object freq": subcommandKey, "object idletime": subcommandKey, "object refcount": subcommandKey, "object help": noKeys},
+	"pubsub": {"pubsub channels": subcommandKey, "pubsub numsub": {first: 2, last: -1}, "pubsub numpat": noKeys},
+	"script": {"script load": noKeys, "script exists": noKeys, "script flush": noKeys, "script kill": noKeys},
+	"xgroup": {"xgroup create": subcommandKey, "xgroup createconsumer": subcommandKey, "xgroup delconsumer": subcommandKey, "xgroup destroy": subcommandKey, "xgroup setid": subcommandKey, "xgroup help": noKeys},
+	"xinfo":  {"xinfo stream": subcommandKey, "xinfo groups": subcommandKey, "xinfo consumers": subcommandKey, "xinfo help": noKeys},
+}
+
+var redisKeySpecs = commandsBySpec(map[redisKeySpec][]string{
+	noKeys: {"ping", "echo", "info", "select", "auth", "hello", "quit", "time", "client", "config", "command", "multi", "exec", "discard", "unwatch", "readonly", "readwrite", "wait", "lastsave", "role"},
+	firstKey: {
+		"get", "set", "setnx", "setex", "psetex", "getset", "getdel", "getex", "append", "strlen", "incr", "incrby", "incrbyfloat", "decr", "decrby", "getrange", "setrange", "getbit", "setbit", "bitcount", "bitpos", "bitfield",
+		"expire", "pexpire", "expireat", "pexpireat", "expiretime", "pexpiretime", "ttl", "pttl", "persist", "type", "dump", "restore", "keys",
+		"hget", "hset", "hsetnx", "hmget", "hmset", "hdel", "hlen", "hexists", "hkeys", "hvals", "hgetall", "hincrby", "hincrbyfloat", "hstrlen", "hscan", "hrandfield",
+		"lpush", "rpush", "lpushx", "rpushx", "lpop", "rpop", "llen", "lindex", "lset", "lrange", "ltrim", "lrem", "linsert", "lpos",
+		"sadd", "srem", "smembers", "sismember", "smismember", "scard", "spop", "srandmember", "sscan",
+		"zadd", "zrem", "zcard", "zcount", "zincrby", "zrange", "zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zrevrange", "zrank", "zrevrank", "zscore", "zmscore", "zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zlexcount", "zpopmin", "zpopmax", "zscan", "zrandmember",
+		"pfadd", "geoadd", "geodist", "geohash", "geopos", "geosearch",
+		"xadd", "xlen", "xrange", "xrevrange", "xdel", "xtrim", "xack", "xpending", "xclaim", "xautoclaim", "xsetid",
+		"publish", "spublish",
+	},
+	twoKeys:                         {"rename", "renamenx", "copy", "smove", "rpoplpush", "lmove", "brpoplpush", "blmove", "zrangestore", "geosearchstore"},
+	allKeys:                         {"del", "unlink", "exists", "touch", "mget", "watch", "sinter", "sunion", "sdiff", "sinterstore", "sunionstore", "sdiffstore", "pfcount", "pfmerge", "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ssubscribe", "sunsubscribe"},
+	blockingKeys:                    {"blpop", "brpop", "bzpopmin", "bzpopmax"},
+	{first: 1, last: -1, step: 2}:   {"mset", "msetnx"},
+	{numKeys: 1}:                    {"zunion", "zinter", "zdiff", "sintercard", "lmpop", "zmpop"},
+	{numKeys: 2}:                    {"eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro", "blmpop", "bzmpop"},
+	{first: 1, last: 1, numKeys: 2}: {"zunionstore", "zinterstore", "zdiffstore"},
+	{streams: true}:                 {"xread", "xreadgroup"},
+	{match: true}:                   {"scan"},
+})
+
+func commandsBySpec(specs map[redisKeySpec][]string) map[string]redisKeySpec {
+	commands := make(map[string]redisKeySpec)
+	for spec, names := range specs {
+		for _, name := range names {
+			commands[name] = spec
+		}
+	}
+	return commands
+}
@@ -0,0 +1,308 @@
+package bucharest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTenantDB(t *testing.T) *sql.DB {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	return db
+}
+
+func serveTenant(ctx Context, middleware HandlerFunc, handler HandlerFunc, req *http.Request, before ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(before...)
+	if middleware != nil {
+		g.Use(NewGinHandlerFunc(ctx, middleware))
+	}
+	g.GET("/", NewGinHandlerFunc(ctx, handler))
+
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+	return res
+}
+
+func tenantRequest(header string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set("X-Tenant", header)
+	}
+	return req
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	root := newTenantDB(t)
+	acme := newTenantDB(t)
+	ctx := NewContextWithOptions(&ContextOptions{SQL: root})
+	registry := NewTenantRegistry(nil)
+	assert.NoError(t, registry.Register("acme", &ContextOptions{SQL: acme}))
+
+	var seen *sql.DB
+	var tenant string
+	res := serveTenant(ctx, registry.Middleware(TenantFromHeader("X-Tenant")), func(ctx HTTPContext) HTTPError {
+		seen = ctx.SQL()
+		tenant = Tenant(ctx)
+		return nil
+	}, tenantRequest("acme"))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, acme, seen)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, root, ctx.SQL())
+
+	res = serveTenant(ctx, registry.Middleware(TenantFromHeader("X-Tenant")), func(HTTPContext) HTTPError { return nil }, tenantRequest("globex"))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = serveTenant(ctx, registry.Middleware(TenantFromHeader("X-Tenant")), func(HTTPContext) HTTPError { return nil }, tenantRequest(""))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestTenantRegistryOpen(t *testing.T) {
+	acme := newTenantDB(t)
+	opened := 0
+	registry := NewTenantRegistry(&TenantOptions{Open: func(tenant string) (*ContextOptions, error) {
+		opened++
+		if tenant != "acme" {
+			return nil, ErrUnknownTenant
+		}
+		return &ContextOptions{SQL: acme}, nil
+	}})
+
+	for i := 0; i < 2; i++ {
+		options, err := registry.Tenant("acme")
+		assert.NoError(t, err)
+		assert.Equal(t, acme, options.SQL)
+	}
+	assert.Equal(t, 1, opened)
+
+	_, err := registry.Tenant("globex")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	openErr := errors.New("connection refused")
+	failing := NewTenantRegistry(&TenantOptions{Open: func(string) (*ContextOptions, error) { return nil, openErr }})
+	res := serveTenant(NewContextWithOptions(nil), failing.Middleware(TenantFromHeader("X-Tenant")), func(HTTPContext) HTTPError { return nil }, tenantRequest("acme"))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
+
+func TestTenantRegistryOpenOutsideLock(t *testing.T) {
+	acme := newTenantDB(t)
+	release := make(chan struct{})
+	var opened atomic.Int32
+	registry := NewTenantRegistry(&TenantOptions{Open: func(tenant string) (*ContextOptions, error) {
+		opened.Add(1)
+		<-release
+		return &ContextOptions{SQL: newTenantDB(t)}, nil
+	}})
+	assert.NoError(t, registry.Register("acme", &ContextOptions{SQL: acme}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := registry.Tenant("slow")
+			assert.NoError(t, err)
+		}()
+	}
+	utils.RunUntil(func() bool { return opened.Load() == 1 }, time.Second)
+
+	// acme is served while slow is still opening.
+	options, err := registry.Tenant("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, acme, options.SQL)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), opened.Load())
+}
+
+func TestTenantReplicasHealthChecked(t *testing.T) {
+	primary := newTenantDB(t)
+	replica, mock := newReplica(t)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	registry := NewTenantRegistry(nil)
+	assert.NoError(t, registry.Register("acme", &ContextOptions{
+		SQL:                        primary,
+		Replicas:                   []Replica{replica},
+		ReplicaHealthCheckInterval: 10 * time.Millisecond,
+	}))
+
+	read := func() *sql.DB {
+		var seen *sql.DB
+		serveTenant(NewContextWithOptions(nil), registry.Middleware(TenantFromHeader("X-Tenant")), func(ctx HTTPContext) HTTPError {
+			seen = ctx.ReadOnly().SQL()
+			return nil
+		}, tenantRequest("acme"))
+		return seen
+	}
+	utils.RunUntil(func() bool { return read() == primary }, time.Second)
+	assert.Same(t, primary, read())
+}
+
+func TestTenantResolvers(t *testing.T) {
+	registry := NewTenantRegistry(nil)
+	assert.NoError(t, registry.Register("acme", &ContextOptions{}))
+	ctx := NewContextWithOptions(nil)
+
+	var tenant string
+	handler := func(ctx HTTPContext) HTTPError {
+		tenant = Tenant(ctx)
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com:8080/", nil)
+	res := serveTenant(ctx, registry.Middleware(TenantFromSubdomain("example.com")), handler, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "acme", tenant)
+
+	req = httptest.NewRequest(http.MethodGet, "http://a.b.example.com/", nil)
+	res = serveTenant(ctx, registry.Middleware(TenantFromSubdomain("example.com")), handler, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	type claims map[string]any
+	tenant = ""
+	setClaims := func(g *gin.Context) { g.Set("claims", claims{"tenant": "acme"}) }
+	res = serveTenant(ctx, registry.Middleware(TenantFromClaim("claims", "tenant")), handler, tenantRequest(""), setClaims)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "acme", tenant)
+
+	res = serveTenant(ctx, registry.Middleware(TenantFromClaim("claims", "tenant")), handler, tenantRequest(""))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestTenantGuard(t *testing.T) {
+	ctx := NewContextWithOptions(&ContextOptions{SQL: newTenantDB(t), RequireTenant: true})
+	assert.PanicsWithValue(t, ErrUnscopedHandle, func() { ctx.SQL() })
+	assert.PanicsWithValue(t, ErrUnscopedHandle, func() { WithTx(ctx, func(Context) error { return nil }) })
+
+	res := serveTenant(ctx, nil, func(ctx HTTPContext) HTTPError {
+		ctx.SQL()
+		return nil
+	}, tenantRequest("acme"))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Contains(t, res.Body.String(), ErrUnscopedHandle.Error())
+
+	registry := NewTenantRegistry(nil)
+	assert.NoError(t, registry.Register("acme", &ContextOptions{SQL: newTenantDB(t)}))
+	res = serveTenant(ctx, registry.Middleware(TenantFromHeader("X-Tenant")), func(ctx HTTPContext) HTTPError {
+		ctx.SQL()
+		return nil
+	}, tenantRequest("acme"))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestTenantRedisKeyPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	shared := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	registry := NewTenantRegistry(&TenantOptions{RedisKeyPrefix: func(tenant string) string { return tenant + ":" }})
+	assert.NoError(t, registry.Register("acme", &ContextOptions{Redis: shared}))
+
+	options, err := registry.Tenant("acme")
+	assert.NoError(t, err)
+	client := options.Redis
+	assert.NotSame(t, shared, client)
+
+	background := context.Background()
+	assert.NoError(t, client.Set(background, "name", "alice", 0).Err())
+	assert.NoError(t, client.MSet(background, "a", "1", "b", "2").Err())
+	assert.NoError(t, client.Eval(background, "return redis.call('SET', KEYS[1], ARGV[1])", []string{"c"}, "3").Err())
+	value, err := client.Get(background, "name").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", value)
+
+	mr.CheckGet(t, "acme:name", "alice")
+	mr.CheckGet(t, "acme:a", "1")
+	mr.CheckGet(t, "acme:b", "2")
+	mr.CheckGet(t, "acme:c", "3")
+	assert.False(t, mr.Exists("name"))
+
+	assert.NoError(t, client.Del(background, "a", "b").Err())
+	assert.False(t, mr.Exists("acme:a"))
+	assert.False(t, mr.Exists("acme:b"))
+}
+
+func TestTenantRedisKeySpecs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	shared := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	registry := NewTenantRegistry(&TenantOptions{RedisKeyPrefix: func(tenant string) string { return tenant + ":" }})
+	assert.NoError(t, registry.Register("acme", &ContextOptions{Redis: shared}))
+	options, err := registry.Tenant("acme")
+	assert.NoError(t, err)
+	client := options.Redis
+	background := context.Background()
+
+	assert.NoError(t, shared.Set(background, "other", "1", 0).Err())
+	assert.NoError(t, client.Set(background, "mine", "1", 0).Err())
+	keys, cursor, err := client.Scan(background, 0, "*", 10).Result()
+	assert.NoError(t, err)
+	assert.Zero(t, cursor)
+	assert.Equal(t, []string{"acme:mine"}, keys)
+	assert.ErrorIs(t, client.Scan(background, 0, "", 10).Err(), ErrUnscopedRedisCommand)
+
+	assert.NoError(t, client.ZAdd(background, "a", &redis.Z{Score: 1, Member: "x"}).Err())
+	assert.NoError(t, client.ZAdd(background, "b", &redis.Z{Score: 2, Member: "x"}).Err())
+	assert.NoError(t, client.ZUnionStore(background, "ab", &redis.ZStore{Keys: []string{"a", "b"}}).Err())
+	score, err := shared.ZScore(background, "acme:ab", "x").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), score)
+
+	id, err := client.XAdd(background, &redis.XAddArgs{Stream: "events", Values: map[string]any{"data": "1"}}).Result()
+	assert.NoError(t, err)
+	assert.NoError(t, client.XGroupCreate(background, "events", "workers", "0").Err())
+	streams, err := client.XRead(background, &redis.XReadArgs{Streams: []string{"events", "0"}, Count: 1}).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "acme:events", streams[0].Stream)
+	assert.Equal(t, id, streams[0].Messages[0].ID)
+	streams, err = client.XReadGroup(background, &redis.XReadGroupArgs{Group: "workers", Consumer: "c", Streams: []string{"events", ">"}}).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, id, streams[0].Messages[0].ID)
+
+	subscriber := shared.Subscribe(background, "acme:news")
+	defer subscriber.Close()
+	_, err = subscriber.Receive(background)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Publish(background, "news", "hello").Err())
+	msg, err := subscriber.ReceiveMessage(background)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", msg.Payload)
+
+	assert.ErrorIs(t, client.FlushAll(background).Err(), ErrUnscopedRedisCommand)
+	assert.ErrorIs(t, client.Do(background, "eval", "return 1", "2", "k").Err(), ErrUnscopedRedisCommand)
+	_, err = client.Pipelined(background, func(pipe redis.Pipeliner) error {
+		pipe.Set(background, "piped", "1", 0)
+		pipe.RandomKey(background)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrUnscopedRedisCommand)
+	assert.False(t, mr.Exists("acme:piped"))
+	assert.True(t, mr.Exists("other"))
+}
+
+func TestTenantRedisKeyPrefixCluster(t *testing.T) {
+	registry := NewTenantRegistry(&TenantOptions{RedisKeyPrefix: func(tenant string) string { return tenant + ":" }})
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"localhost:0"}})
+	defer cluster.Close()
+	assert.NoError(t, registry.Register("acme", &ContextOptions{Redis: cluster}))
+
+	options, err := registry.Tenant("acme")
+	assert.NoError(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, options.Redis)
+	assert.NotSame(t, cluster, options.Redis)
+}
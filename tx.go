@@ -0,0 +1,148 @@
+package bucharest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+)
+
+var ErrPoolInTx = errors.New("SQL() and SQLX() run outside the transaction, use SQLHandle() and SQLXHandle() inside WithTx")
+var ErrTxPoolMismatch = errors.New("SQL, SQLX and GORM must share one *sql.DB to run in a transaction, see NewContextOptionsFromSQL")
+
+type transaction struct {
+	sql   *sql.Tx
+	sqlx  *sqlx.Tx
+	depth int
+	// pool is the GORM of the context that began the transaction, which
+	// Detach restores.
+	pool *gorm.DB
+}
+
+// WithTx runs fn in a transaction. The child context's GORM(), SQLHandle() and
+// SQLXHandle() run inside the transaction. SQL() and SQLX() still return the
+// pools, which run outside of it, and log ErrPoolInTx as a warning. Nested
+// calls use savepoints.
+func WithTx(ctx Context, fn func(txCtx Context) error) error {
+	return WithTxOptions(ctx, nil, fn)
+}
+
+func WithTxOptions(ctx Context, options *sql.TxOptions, fn func(txCtx Context) error) (err error) {
+	parent := baseOf(ctx)
+	if parent.tx != nil {
+		return withSavepoint(ctx, parent, fn)
+	}
+	if parent.primary != nil {
+		parent = parent.primary
+	}
+
+	child, err := beginTx(ctx, parent, options)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			child.tx.sql.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = fn(child); err != nil {
+		if rollbackErr := child.tx.sql.Rollback(); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	return child.tx.sql.Commit()
+}
+
+func InTx(ctx Context) bool {
+	return baseOf(ctx).tx != nil
+}
+
+func beginTx(ctx Context, parent *BuchatrestContext, options *sql.TxOptions) (*BuchatrestContext, error) {
+	db, err := parent.txPool()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &transaction{depth: 1, pool: parent.gorm_}
+	if parent.sqlx_ != nil {
+		tx.sqlx, err = parent.queryLog.sqlx(parent.sqlx_).BeginTxx(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		tx.sql = tx.sqlx.Tx
+	} else {
+		tx.sql, err = parent.queryLog.sql(db).BeginTx(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	child := parent.derive(ctx)
+	child.tx = tx
+	if parent.gorm_ != nil {
+		child.gorm_ = parent.gorm_.Session(&gorm.Session{Context: ctx})
+		child.gorm_.Statement.ConnPool = tx.sql
+	}
+	return child, nil
+}
+
+func withSavepoint(ctx Context, parent *BuchatrestContext, fn func(txCtx Context) error) (err error) {
+	child := parent.derive(ctx)
+	child.tx = &transaction{sql: parent.tx.sql, sqlx: parent.tx.sqlx, depth: parent.tx.depth + 1, pool: parent.tx.pool}
+	savepoint := fmt.Sprintf("bucharest_tx_%d", child.tx.depth)
+
+	if _, err := child.tx.sql.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			child.tx.sql.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(r)
+		}
+	}()
+
+	if err = fn(child); err != nil {
+		if _, rollbackErr := child.tx.sql.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	_, err = child.tx.sql.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
+
+func (ctx *BuchatrestContext) txPool() (*sql.DB, error) {
+	ctx.guardTenant()
+	db := ctx.sql_
+	if db == nil && ctx.sqlx_ != nil {
+		db = ctx.sqlx_.DB
+	}
+	if db == nil && ctx.gorm_ != nil {
+		gormDB, err := ctx.gorm_.DB()
+		if err != nil {
+			return nil, err
+		}
+		db = gormDB
+	}
+	if db == nil {
+		return nil, ErrNoSQL
+	}
+
+	if ctx.sqlx_ != nil && ctx.sqlx_.DB != db {
+		return nil, ErrTxPoolMismatch
+	}
+	if ctx.gorm_ != nil {
+		gormDB, err := ctx.gorm_.DB()
+		if err != nil || gormDB != db {
+			return nil, ErrTxPoolMismatch
+		}
+	}
+	return db, nil
+}
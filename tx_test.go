@@ -0,0 +1,155 @@
+package bucharest_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/argonlab-io/bucharest/utils"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWithTxCommit(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	logger, hook := test.NewNullLogger()
+	ctx.Update(&ContextOptions{Logrus: logger})
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := WithTx(ctx, func(txCtx Context) error {
+		assert.NotSame(t, ctx.GORM(), txCtx.GORM())
+		assert.Same(t, ctx.SQL(), txCtx.SQL())
+		assert.Same(t, ctx.SQLX(), txCtx.SQLX())
+		assert.Len(t, hook.AllEntries(), 2)
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Equal(t, ErrPoolInTx.Error(), hook.LastEntry().Message)
+		assert.IsType(t, &sql.Tx{}, txCtx.SQLHandle())
+		assert.IsType(t, &sqlx.Tx{}, txCtx.SQLXHandle())
+
+		_, err := txCtx.SQLHandle().ExecContext(txCtx, "UPDATE foo SET bar = $1", 1)
+		assert.NoError(t, err)
+		_, err = txCtx.SQLXHandle().ExecContext(txCtx, txCtx.SQLXHandle().Rebind("UPDATE foo SET bar = ?"), 2)
+		assert.NoError(t, err)
+		return txCtx.GORM().Exec("UPDATE foo SET bar = ?", 3).Error
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Same(t, ctx.SQL(), ctx.SQLHandle())
+	assert.Same(t, ctx.SQLX(), ctx.SQLXHandle())
+}
+
+func TestWithTxRollbackOnError(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fnErr := errors.New("foobar")
+	err := WithTx(ctx, func(txCtx Context) error { return fnErr })
+	assert.ErrorIs(t, err, fnErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxRollbackOnPanic(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	utils.AssertPanic(t, func() {
+		WithTx(ctx, func(txCtx Context) error { panic("foobar") })
+	}, "foobar")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxNestedSavepoints(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT bucharest_tx_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT bucharest_tx_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT bucharest_tx_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT bucharest_tx_3").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT bucharest_tx_3").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT bucharest_tx_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	fnErr := errors.New("foobar")
+	err := WithTx(ctx, func(txCtx Context) error {
+		err := WithTx(txCtx, func(nested Context) error {
+			assert.Same(t, txCtx.SQLHandle(), nested.SQLHandle())
+			return nil
+		})
+		assert.NoError(t, err)
+
+		err = WithTx(txCtx, func(nested Context) error {
+			return WithTx(nested, func(Context) error { return fnErr })
+		})
+		assert.ErrorIs(t, err, fnErr)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxWithoutSQLX(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	ctx := NewContextWithOptions(&ContextOptions{SQL: db})
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	err = WithTx(ctx, func(txCtx Context) error {
+		assert.IsType(t, &sql.Tx{}, txCtx.SQLHandle())
+		utils.AssertPanic(t, func() { txCtx.SQLXHandle() }, ErrNoSQLX)
+		utils.AssertPanic(t, func() { txCtx.GORM() }, ErrNoGORM)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTxErrors(t *testing.T) {
+	err := WithTx(NewContextWithOptions(nil), func(Context) error { return nil })
+	assert.ErrorIs(t, err, ErrNoSQL)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	other, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	ctx := NewContextWithOptions(&ContextOptions{SQL: db, SQLX: sqlx.NewDb(other, "sqlmock")})
+	err = WithTx(ctx, func(Context) error { return nil })
+	assert.ErrorIs(t, err, ErrTxPoolMismatch)
+
+	gormDB, err := gorm.Open(postgresDialectorFor(other), &gorm.Config{})
+	assert.NoError(t, err)
+	ctx = NewContextWithOptions(&ContextOptions{SQL: db, GORM: gormDB})
+	err = WithTx(ctx, func(Context) error { return nil })
+	assert.ErrorIs(t, err, ErrTxPoolMismatch)
+
+	ctx, mock := newMockContext(t)
+	beginErr := errors.New("begin")
+	mock.ExpectBegin().WillReturnError(beginErr)
+	err = WithTx(ctx, func(Context) error { return nil })
+	assert.ErrorIs(t, err, beginErr)
+}
+
+func TestInTx(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	assert.False(t, InTx(ctx))
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.NoError(t, WithTx(ctx, func(txCtx Context) error {
+		assert.True(t, InTx(txCtx))
+		return nil
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,109 @@
+package bucharest
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUnitOfWorkRollback = errors.New("the request failed, rolling back the unit of work")
+
+// UnitOfWork is an opt-in middleware that runs the rest of the handler chain in
+// one transaction. It commits when no handler returns an HTTPError and the
+// response status is below 400, and rolls back otherwise or on panic. The
+// response is buffered until the transaction ends, so that a failed commit
+// responds with 500 instead of the status of the handler.
+func UnitOfWork(ctx HTTPContext) HTTPError {
+	writer := ctx.Gin().Writer
+	buffer := &bufferedWriter{ResponseWriter: writer, header: writer.Header().Clone(), size: -1}
+	err := WithTx(ctx, func(txCtx Context) error {
+		defer scopeContext(ctx, txCtx)()
+		ctx.Gin().Writer = buffer
+		defer func() { ctx.Gin().Writer = writer }()
+
+		ctx.Next()
+
+		if _, failed := ctx.Get(httpErrorKey); failed || buffer.Status() >= http.StatusBadRequest {
+			return errUnitOfWorkRollback
+		}
+		return nil
+	})
+	if err == nil || errors.Is(err, errUnitOfWorkRollback) {
+		buffer.flush()
+		return nil
+	}
+
+	ctx.Gin().Error(err)
+	ctx.Abort()
+	return NewInternalServerError(err)
+}
+
+// bufferedWriter holds the response of the handlers until flush.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	size   int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.body.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.size
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.size != -1
+}
+
+// Flush is a no-op, the response is only sent once the transaction ends.
+func (w *bufferedWriter) Flush() {}
+
+func (w *bufferedWriter) flush() {
+	header := w.ResponseWriter.Header()
+	clear(header)
+	maps.Copy(header, w.header)
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.Written() {
+		w.ResponseWriter.WriteHeaderNow()
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
@@ -0,0 +1,178 @@
+package bucharest_test
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/argonlab-io/bucharest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveUnitOfWork(ctx Context, handler HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(gin.CustomRecovery(func(c *gin.Context, _ any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+	g.Use(NewGinHandlerFunc(ctx, UnitOfWork))
+	g.GET("/", NewGinHandlerFunc(ctx, handler))
+
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	return res
+}
+
+func serveHandler(ctx Context, handler HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.GET("/", NewGinHandlerFunc(ctx, handler))
+
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	return res
+}
+
+func TestUnitOfWorkCommit(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE foo SET bar = $1").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		assert.IsType(t, &sql.Tx{}, h.SQLHandle())
+		if err := h.GORM().Exec("UPDATE foo SET bar = ?", 1).Error; err != nil {
+			return NewInternalServerError(err)
+		}
+		if _, err := h.SQLXHandle().ExecContext(h, "UPDATE foo SET bar = $1", 2); err != nil {
+			return NewInternalServerError(err)
+		}
+		h.Status(http.StatusNoContent)
+		return nil
+	})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Same(t, ctx.SQL(), ctx.SQLHandle())
+}
+
+func TestUnitOfWorkPoolsStillWork(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+	mock.ExpectCommit()
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		var one int
+		if err := h.SQLX().Get(&one, "SELECT 1"); err != nil {
+			return NewInternalServerError(err)
+		}
+		h.Status(http.StatusNoContent)
+		return nil
+	})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkRollbackOnHTTPError(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		return NewBadRequestError(errors.New("foobar"))
+	})
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkRollbackOnErrorStatus(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		h.JSON(http.StatusConflict, gin.H{"message": "conflict"})
+		return nil
+	})
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkRollbackOnPanic(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError { panic("foobar") })
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkBeginError(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin().WillReturnError(errors.New("begin"))
+
+	called := false
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		called = true
+		return nil
+	})
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.False(t, called)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkCommitError(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("commit"))
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError { return nil })
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkCommitErrorAfterWrite(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("commit"))
+
+	res := serveUnitOfWork(ctx, func(h HTTPContext) HTTPError {
+		h.Header("Location", "/foo/1")
+		h.JSON(http.StatusCreated, gin.H{"id": 1})
+		return nil
+	})
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Empty(t, res.Header().Get("Location"))
+	assert.NotContains(t, res.Body.String(), `"id"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWorkFlushesResponse(t *testing.T) {
+	ctx, mock := newMockContext(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(NewGinHandlerFunc(ctx, AssignRequestID))
+	g.Use(NewGinHandlerFunc(ctx, UnitOfWork))
+	g.GET("/", NewGinHandlerFunc(ctx, func(h HTTPContext) HTTPError {
+		h.Header("Location", "/foo/1")
+		h.JSON(http.StatusCreated, gin.H{"id": 1})
+		return nil
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "request-1")
+	res := httptest.NewRecorder()
+	g.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/foo/1", res.Header().Get("Location"))
+	assert.Equal(t, "request-1", res.Header().Get(RequestIDHeader))
+	assert.JSONEq(t, `{"id":1}`, res.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,11 +2,16 @@ package utils
 
 import (
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 )
 
+var ErrInvalidCiphertext = errors.New("the ciphertext is too short to contain a nonce")
+
 type encoder struct {
 	plaintext string
 	bytes     []byte
@@ -66,6 +71,15 @@ func (e *encoder) Hex(alg crypto.Hash) (string) {
 	return hex.EncodeToString(e.Hash(alg))
 }
 
+func (e *encoder) Seal(key []byte) (*encoder, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := NewEncoder(nil).Random(gcm.NonceSize()).Bytes()
+	return e.ReadBytes(gcm.Seal(nonce, nonce, e.bytes, nil)), nil
+}
+
 func NewDecoder(b64 string) *decoder {
 	return &decoder{
 		base64: b64,
@@ -80,3 +94,25 @@ func (d *decoder) Bytes() ([]byte, error) {
 	return base64.RawStdEncoding.Strict().DecodeString(d.base64)
 }
 
+func (d *decoder) Open(key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -43,3 +43,29 @@ func TestHex(t *testing.T) {
 	hex = NewEncoder(&foobar).Hex(0)
 	assert.Equal(t, hex, "666f6f626172")
 }
+
+func TestSealAndOpen(t *testing.T) {
+	key := NewEncoder(nil).Random(32).Bytes()
+	foobar := "foobar"
+	sealed, err := NewEncoder(&foobar).Seal(key)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed.Bytes(), []byte(foobar))
+
+	opened, err := NewDecoder(sealed.Base64()).Open(key)
+	assert.NoError(t, err)
+	assert.Equal(t, string(opened), foobar)
+
+	_, err = NewDecoder(sealed.Base64()).Open(NewEncoder(nil).Random(32).Bytes())
+	assert.Error(t, err)
+}
+
+func TestSealAndOpenError(t *testing.T) {
+	_, err := NewEncoder(nil).Seal([]byte("short"))
+	assert.Error(t, err)
+
+	_, err = NewDecoder("Zm9v").Open(NewEncoder(nil).Random(16).Bytes())
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = NewDecoder("!!!").Open(NewEncoder(nil).Random(16).Bytes())
+	assert.Error(t, err)
+}